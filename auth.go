@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AuthConfig holds the credentials of an endpoint. At most one of basic
+// auth, a bearer token and a JWT secret may be set. Secrets can be read from
+// files so they stay out of the endpoints file.
+type AuthConfig struct {
+	// Username and Password are sent with HTTP basic auth, as expected by
+	// nodes started with rpcuser and rpcpass.
+	Username     string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password     string `json:"password,omitempty" yaml:"password,omitempty"`
+	PasswordFile string `json:"password_file,omitempty" yaml:"password_file,omitempty"`
+	// BearerToken is sent as is in the Authorization header.
+	BearerToken     string `json:"bearer_token,omitempty" yaml:"bearer_token,omitempty"`
+	BearerTokenFile string `json:"bearer_token_file,omitempty" yaml:"bearer_token_file,omitempty"`
+	// JWTSecretFile holds a shared secret, hex encoded or raw. Every request
+	// carries a fresh HS256 token signed with it, with an iat claim.
+	JWTSecretFile string `json:"jwt_secret_file,omitempty" yaml:"jwt_secret_file,omitempty"`
+}
+
+// TLSConfig configures TLS for https:// and wss:// endpoints.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of the authorities trusted to sign the node's
+	// certificate, instead of the system roots.
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are the PEM client certificate and key presented
+	// to nodes that require mutual TLS.
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	// ServerName overrides the name the node's certificate is checked for.
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+}
+
+// Method returns the kind of credentials configured: "basic", "bearer",
+// "jwt" or "".
+func (a *AuthConfig) Method() string {
+	switch {
+	case a == nil:
+		return ""
+	case a.JWTSecretFile != "":
+		return "jwt"
+	case a.BearerToken != "" || a.BearerTokenFile != "":
+		return "bearer"
+	case a.Username != "" || a.Password != "" || a.PasswordFile != "":
+		return "basic"
+	}
+	return ""
+}
+
+// resolve makes the file paths of a relative to dir.
+func (a *AuthConfig) resolve(dir string) {
+	a.PasswordFile = resolvePath(dir, a.PasswordFile)
+	a.BearerTokenFile = resolvePath(dir, a.BearerTokenFile)
+	a.JWTSecretFile = resolvePath(dir, a.JWTSecretFile)
+}
+
+// resolve makes the file paths of t relative to dir.
+func (t *TLSConfig) resolve(dir string) {
+	t.CAFile = resolvePath(dir, t.CAFile)
+	t.CertFile = resolvePath(dir, t.CertFile)
+	t.KeyFile = resolvePath(dir, t.KeyFile)
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// readSecret returns value, or the trimmed contents of file if set.
+func readSecret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// authorizer loads the credentials of a and returns a function producing
+// the Authorization header of a request, or nil if a sets none.
+func (a *AuthConfig) authorizer() (func() (string, error), error) {
+	kinds := 0
+	if a.Username != "" || a.Password != "" || a.PasswordFile != "" {
+		kinds++
+	}
+	if a.BearerToken != "" || a.BearerTokenFile != "" {
+		kinds++
+	}
+	if a.JWTSecretFile != "" {
+		kinds++
+	}
+	if kinds > 1 {
+		return nil, fmt.Errorf("auth: set only one of basic auth, bearer_token and jwt_secret_file")
+	}
+
+	switch a.Method() {
+	case "basic":
+		password, err := readSecret(a.Password, a.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: reading password_file: %v", err)
+		}
+		header := "Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+password))
+		return func() (string, error) { return header, nil }, nil
+	case "bearer":
+		token, err := readSecret(a.BearerToken, a.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth: reading bearer_token_file: %v", err)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("auth: empty bearer token")
+		}
+		header := "Bearer " + token
+		return func() (string, error) { return header, nil }, nil
+	case "jwt":
+		secret, err := loadJWTSecret(a.JWTSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		return func() (string, error) {
+			token, err := signJWT(secret, time.Now())
+			if err != nil {
+				return "", err
+			}
+			return "Bearer " + token, nil
+		}, nil
+	}
+	return nil, nil
+}
+
+// loadJWTSecret reads a JWT secret file. Like the engine API secrets of
+// geth, a hex encoded secret, with or without 0x, is decoded; anything else
+// is used as is.
+func loadJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: reading jwt_secret_file: %v", err)
+	}
+	text := strings.TrimPrefix(strings.TrimSpace(string(data)), "0x")
+	if secret, err := hex.DecodeString(text); err == nil && len(secret) > 0 {
+		return secret, nil
+	}
+	if text == "" {
+		return nil, fmt.Errorf("auth: empty jwt_secret_file")
+	}
+	return []byte(text), nil
+}
+
+// signJWT returns an HS256 JWT issued at now.
+func signJWT(secret []byte, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{"iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// clientConfig loads the certificates of t.
+func (t *TLSConfig) clientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: reading ca_file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates in ca_file %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, fmt.Errorf("tls: cert_file and key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
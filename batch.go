@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxBatchSize bounds the number of blocks and transactions one
+// qng_get_blocks_and_txs call may request.
+const maxBatchSize = 100
+
+// batchItem is one element of the qng_get_blocks_and_txs result. Exactly one
+// of Result and Error is set.
+type batchItem struct {
+	Order  *uint64         `json:"order,omitempty"`
+	TxHash string          `json:"tx_hash,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *ToolError      `json:"error,omitempty"`
+}
+
+// batchArg reads an optional array argument.
+func batchArg(args map[string]interface{}, name string) ([]interface{}, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, invalidArgument(name, "invalid argument %s: expected a JSON array, got %T", name, v)
+	}
+	return list, nil
+}
+
+// handleGetBlocksAndTxs handles the qng_get_blocks_and_txs tool request. All
+// blocks and transactions are fetched in one JSON-RPC batch; an element that
+// fails is reported in place without failing the others.
+func (s *MCPServer) handleGetBlocksAndTxs(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	orders, err := batchArg(args, "block_orders")
+	if err != nil {
+		return toolErrorResult("", err)
+	}
+	hashes, err := batchArg(args, "tx_hashes")
+	if err != nil {
+		return toolErrorResult("", err)
+	}
+	if len(orders)+len(hashes) == 0 {
+		return toolErrorResult("", invalidArgument("block_orders", "pass at least one block order or transaction hash"))
+	}
+	if n := len(orders) + len(hashes); n > maxBatchSize {
+		return toolErrorResult("", invalidArgument("block_orders", "%d items requested, at most %d are allowed per call", n, maxBatchSize))
+	}
+	verbose := true
+	if v, ok := args["verbose"]; ok && v != nil {
+		if verbose, err = toBool(v); err != nil {
+			return toolErrorResult("", invalidArgument("verbose", "invalid argument verbose: %v", err))
+		}
+	}
+	rpc, err := s.networkArg(args)
+	if err != nil {
+		return toolErrorResult("", err)
+	}
+
+	items := make([]batchItem, 0, len(orders)+len(hashes))
+	calls := make([]BatchCall, 0, len(orders)+len(hashes))
+	for i, v := range orders {
+		order, err := toUint64(v)
+		if err != nil {
+			return toolErrorResult("qng_getBlockByOrder", invalidArgument("block_orders", "invalid argument block_orders[%d]: %v", i, err))
+		}
+		items = append(items, batchItem{Order: &order})
+		calls = append(calls, BatchCall{Method: "qng_getBlockByOrder", Params: []interface{}{order, verbose}})
+	}
+	for i, v := range hashes {
+		hash, err := toHash(v)
+		if err != nil {
+			return toolErrorResult("qng_getRawTransaction", invalidArgument("tx_hashes", "invalid argument tx_hashes[%d]: %v", i, err))
+		}
+		items = append(items, batchItem{TxHash: hash})
+		calls = append(calls, BatchCall{Method: "qng_getRawTransaction", Params: []interface{}{hash, verbose}})
+	}
+
+	results, err := rpc.CallBatch(ctx, calls)
+	if err != nil {
+		log.Debug("handleGetBlocksAndTxs", "error", err)
+		return toolErrorResult("", err)
+	}
+	failed := 0
+	for i, r := range results {
+		if r.Err != nil {
+			items[i].Error = asToolError(calls[i].Method, r.Err)
+			failed++
+			continue
+		}
+		items[i].Result = r.Result
+	}
+	log.Debug("handleGetBlocksAndTxs", "items", len(items), "failed", failed)
+	return jsonToolResult(map[string]interface{}{
+		"items":  items,
+		"failed": failed,
+	})
+}
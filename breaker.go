@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+)
+
+// Circuit breaker states.
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed = "closed"
+	// BreakerOpen rejects requests until the cooldown has passed.
+	BreakerOpen = "open"
+	// BreakerHalfOpen lets a few probe requests through; their outcome
+	// closes or reopens the breaker.
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerConfig configures the circuit breaker of an endpoint.
+type BreakerConfig struct {
+	// Failures is the number of consecutive failures that opens the
+	// breaker. 0 disables the breaker.
+	Failures int
+	// Cooldown is how long the breaker stays open before probing.
+	Cooldown time.Duration
+	// Probes is the number of requests let through while half open.
+	Probes int
+}
+
+// defaultBreakerConfig applies to endpoints of clients that do not set
+// their own. The breaker flags update it at startup.
+var defaultBreakerConfig = BreakerConfig{
+	Failures: 5,
+	Cooldown: 30 * time.Second,
+	Probes:   1,
+}
+
+// backoffError is returned without contacting an endpoint that is failing
+// or overloaded. Callers should wait RetryAfter before trying again.
+type backoffError struct {
+	Endpoint string
+	// Reason is "circuit_open" or "queue_full".
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *backoffError) Error() string {
+	return fmt.Sprintf("endpoint %s rejected the request (%s), retry after %s", e.Endpoint, e.Reason, e.RetryAfter)
+}
+
+// breaker is a circuit breaker. Consecutive failures open it, after the
+// cooldown it lets probes through and closes again once a probe succeeds.
+type breaker struct {
+	name   string
+	config BreakerConfig
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int
+	// generation counts the transitions, so that requests admitted in an
+	// earlier state can be told apart.
+	generation uint64
+}
+
+// admission is handed out by allow for a request it lets through: the
+// generation of the breaker at that time and whether the request is a
+// probe. record and release only act on admissions of the current
+// generation, so a slow request admitted before the breaker opened neither
+// closes it nor frees a probe slot.
+type admission struct {
+	generation uint64
+	probe      bool
+}
+
+func newBreaker(name string, config BreakerConfig) *breaker {
+	if config.Probes < 1 {
+		config.Probes = 1
+	}
+	return &breaker{name: name, config: config, state: BreakerClosed}
+}
+
+// State returns the current state of the breaker.
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.config.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a request may be sent. A request that is allowed
+// must be finished with record or release, passing on its admission.
+func (b *breaker) allow() (admission, error) {
+	if b.config.Failures <= 0 {
+		return admission{}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		if wait := b.config.Cooldown - time.Since(b.openedAt); wait > 0 {
+			return admission{}, &backoffError{Endpoint: b.name, Reason: "circuit_open", RetryAfter: wait}
+		}
+		b.transition(BreakerHalfOpen, "cooldown passed")
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.config.Probes {
+			return admission{}, &backoffError{Endpoint: b.name, Reason: "circuit_open", RetryAfter: time.Second}
+		}
+		b.probes++
+		return admission{generation: b.generation, probe: true}, nil
+	}
+	return admission{generation: b.generation}, nil
+}
+
+// record finishes an allowed request. failed is true when the endpoint
+// could not serve it. Requests admitted before the last transition are not
+// counted.
+func (b *breaker) record(a admission, failed bool) {
+	if b.config.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a.generation != b.generation {
+		return
+	}
+	switch {
+	case !a.probe:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		if b.failures++; b.failures >= b.config.Failures {
+			b.open(fmt.Sprintf("%d consecutive failures", b.failures))
+		}
+	case failed:
+		b.open("probe failed")
+	default:
+		b.failures = 0
+		b.transition(BreakerClosed, "probe succeeded")
+	}
+}
+
+// release finishes an allowed request whose outcome says nothing about the
+// endpoint, such as one cancelled by the caller.
+func (b *breaker) release(a admission) {
+	if b.config.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a.probe && a.generation == b.generation {
+		b.probes--
+	}
+}
+
+func (b *breaker) open(reason string) {
+	b.openedAt = time.Now()
+	b.transition(BreakerOpen, reason)
+}
+
+// transition changes the state, logging and counting the change. Probes in
+// flight belong to the previous generation and no longer hold a slot. b.mu
+// is held.
+func (b *breaker) transition(to, reason string) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.probes = 0
+	metrics.Inc("breaker_transitions_total", "endpoint", b.name, "to", to)
+	if to == BreakerOpen {
+		log.Warn("Circuit breaker opened", "endpoint", b.name, "from", from, "reason", reason, "cooldown", b.config.Cooldown)
+	} else {
+		log.Info("Circuit breaker state changed", "endpoint", b.name, "from", from, "to", to, "reason", reason)
+	}
+}
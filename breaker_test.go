@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker("breaker-test", BreakerConfig{Failures: 2, Cooldown: 50 * time.Millisecond})
+	opened := metrics.Get("breaker_transitions_total", "endpoint", "breaker-test", "to", BreakerOpen)
+
+	for i := 0; i < 2; i++ {
+		a, err := b.allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.record(a, true)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("Expected the breaker to open, got %s", b.State())
+	}
+	var backoffErr *backoffError
+	if _, err := b.allow(); !errors.As(err, &backoffErr) || backoffErr.Reason != "circuit_open" || backoffErr.RetryAfter <= 0 {
+		t.Errorf("Expected an open breaker to reject requests, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("Expected a probe after the cooldown, got %v", err)
+	}
+	if _, err := b.allow(); err == nil {
+		t.Error("Expected a single probe while half open")
+	}
+	b.record(probe, true)
+	if b.State() != BreakerOpen {
+		t.Fatalf("Expected a failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	probe, err = b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.record(probe, false)
+	if b.State() != BreakerClosed {
+		t.Errorf("Expected a successful probe to close the breaker, got %s", b.State())
+	}
+	if n := metrics.Get("breaker_transitions_total", "endpoint", "breaker-test", "to", BreakerOpen) - opened; n != 2 {
+		t.Errorf("Expected 2 counted openings, got %d", n)
+	}
+}
+
+// TestBreakerSlowRequests checks that requests admitted before the breaker
+// opened do not decide its state when they finish after the cooldown.
+func TestBreakerSlowRequests(t *testing.T) {
+	b := newBreaker("breaker-slow-test", BreakerConfig{Failures: 1, Cooldown: 50 * time.Millisecond})
+	slowOK, _ := b.allow()
+	slowCancelled, _ := b.allow()
+	slowFailed, _ := b.allow()
+	failed, _ := b.allow()
+	b.record(failed, true)
+	if b.State() != BreakerOpen {
+		t.Fatalf("Expected the breaker to open, got %s", b.State())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("Expected a probe after the cooldown, got %v", err)
+	}
+	b.record(slowOK, false)
+	b.release(slowCancelled)
+	if b.State() != BreakerHalfOpen {
+		t.Errorf("Expected a slow request not to close the breaker, got %s", b.State())
+	}
+	if _, err := b.allow(); err == nil {
+		t.Error("Expected a slow request not to free the probe slot")
+	}
+
+	b.record(probe, false)
+	b.record(slowFailed, true)
+	if b.State() != BreakerClosed {
+		t.Errorf("Expected a slow failure not to reopen the breaker, got %s", b.State())
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: time.Second, MaxAttempts: 1}
+	}
+	c := NewClient(srv.URL, WithRetryPolicy(once), WithBreaker(BreakerConfig{Failures: 2, Cooldown: time.Minute}))
+	for i := 0; i < 3; i++ {
+		_, err := c.CallRaw(context.Background(), "qng_getNodeInfo", nil)
+		toolErr := asToolError("qng_getNodeInfo", err)
+		if i < 2 && toolErr.Kind != ErrorUpstream {
+			t.Errorf("Expected call %d to reach the node, got %+v", i, toolErr)
+		}
+		if i == 2 && (toolErr.Kind != ErrorUnavailable || toolErr.Class != "circuit_open" || toolErr.RetryAfter != 60 || toolErr.Hint == "") {
+			t.Errorf("Expected the open breaker to fail fast, got %+v", toolErr)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected 2 requests to reach the node, got %d", hits.Load())
+	}
+	if s := c.Endpoints()[0]; s.Breaker != BreakerOpen || s.Rejected != 1 {
+		t.Errorf("Unexpected endpoint status: %+v", s)
+	}
+}
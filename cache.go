@@ -0,0 +1,406 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Cache modes of a catalog method, telling how deep below the tip its
+// result is and so whether the result can still change.
+const (
+	// CacheOrder methods take a block order as their first param. The
+	// depth is measured against qng_getBlockCount.
+	CacheOrder = "order"
+	// CacheConfirmations methods return an object with a confirmations
+	// field, such as verbose blocks and transactions.
+	CacheConfirmations = "confirmations"
+)
+
+// cacheModes lists the valid values of Method.Cache.
+var cacheModes = map[string]struct{}{
+	CacheOrder:         {},
+	CacheConfirmations: {},
+}
+
+// CacheConfig configures the response cache of a Client.
+type CacheConfig struct {
+	// Size is the most results kept; the least recently used are evicted
+	// first. 0 disables the cache.
+	Size int
+	// FinalDepth is the confirmation depth from which a result is
+	// considered immutable and kept until evicted. QNG itself treats blocks
+	// 10 deep as stable (meerdag.StableConfirmations).
+	FinalDepth uint64
+	// TipTTL is how long results closer to the tip are reused. The block
+	// count depths are measured against is reused as long.
+	TipTTL time.Duration
+	// Disk, if set, also keeps final results on disk so that they survive
+	// restarts. Results missing from memory are looked up there.
+	Disk *DiskCache
+}
+
+// defaultCacheConfig is the cache set with -cache-size, -cache-final-depth
+// and -cache-tip-ttl.
+var defaultCacheConfig = CacheConfig{
+	Size:       1024,
+	FinalDepth: 10,
+	TipTTL:     5 * time.Second,
+}
+
+// WithCache caches the results of the catalog methods that declare a cache
+// mode, see CacheConfig.
+func WithCache(config CacheConfig) ClientOption {
+	return func(c *Client) {
+		if config.Size > 0 {
+			c.cache = newResponseCache(config)
+		}
+	}
+}
+
+// CacheStats is a snapshot of a response cache.
+type CacheStats struct {
+	Entries int `json:"entries"`
+	// Final counts the entries that never expire.
+	Final     int     `json:"final"`
+	Size      int     `json:"size"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	Evictions uint64  `json:"evictions"`
+	// Disk describes the disk cache, if any.
+	Disk *DiskCacheStats `json:"disk,omitempty"`
+}
+
+// cacheEntry is a cached result. A zero expires marks a final result.
+type cacheEntry struct {
+	key     string
+	result  json.RawMessage
+	expires time.Time
+}
+
+// responseCache is an LRU cache of RPC results keyed by method and
+// canonical params. It is safe for concurrent use.
+type responseCache struct {
+	config CacheConfig
+	// namespace groups the results of this cache in the disk cache, the
+	// network of the client's endpoints. Without one it is the network
+	// the node reports, asked in the background with lookupNamespace.
+	// lookingUp is set while it runs, and after lookupFailures failed
+	// lookups the next one waits until nextLookup.
+	namespace       string
+	lookupNamespace func() (string, error)
+	namespaceMu     sync.Mutex
+	lookingUp       bool
+	lookupFailures  int
+	nextLookup      time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	final   int
+	stats   CacheStats
+	// count is the last block count and countAt when it was fetched.
+	count   uint64
+	countAt time.Time
+}
+
+func newResponseCache(config CacheConfig) *responseCache {
+	return &responseCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the result cached under key unless it expired. Results
+// missing from memory are looked up in the disk cache.
+func (rc *responseCache) get(key, method string) (json.RawMessage, bool) {
+	result, ok := rc.getMemory(key)
+	if !ok && rc.config.Disk != nil {
+		if namespace := rc.diskNamespace(); namespace != "" {
+			if result, ok = rc.config.Disk.Get(namespace, key); ok {
+				rc.insert(key, result, 0)
+			}
+		}
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if ok {
+		rc.stats.Hits++
+		metrics.Inc("rpc_cache_hits_total", "method", method)
+		return result, true
+	}
+	rc.stats.Misses++
+	metrics.Inc("rpc_cache_misses_total", "method", method)
+	return nil, false
+}
+
+// getMemory returns the result kept in memory under key unless it expired.
+func (rc *responseCache) getMemory(key string) (json.RawMessage, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if e.expires.IsZero() || time.Now().Before(e.expires) {
+		rc.lru.MoveToFront(el)
+		return e.result, true
+	}
+	rc.remove(el)
+	return nil, false
+}
+
+// put caches result under key for ttl, or until evicted if ttl is 0. Final
+// results are written to the disk cache too.
+func (rc *responseCache) put(key string, result json.RawMessage, ttl time.Duration) {
+	rc.insert(key, result, ttl)
+	if ttl == 0 && rc.config.Disk != nil {
+		if namespace := rc.diskNamespace(); namespace != "" {
+			if err := rc.config.Disk.Put(namespace, key, result); err != nil {
+				log.Warn("Cannot write to the disk cache", "error", err)
+			}
+		}
+	}
+}
+
+// namespaceRetry paces the lookups of the node's network after failures.
+var namespaceRetry = RetryPolicy{
+	Backoff: Backoff{
+		Initial:    Duration(time.Second),
+		Max:        Duration(time.Minute),
+		Multiplier: 2,
+	},
+}
+
+// diskNamespace returns the namespace of the results in the disk cache, or
+// "" while the network of the node is not known, in which case the disk
+// cache is left alone: results of another chain must not be mixed in.
+func (rc *responseCache) diskNamespace() string {
+	rc.namespaceMu.Lock()
+	defer rc.namespaceMu.Unlock()
+	if rc.namespace == "" {
+		rc.resolveNamespace()
+	}
+	return rc.namespace
+}
+
+// resolveNamespace looks up the network of the node in the background,
+// unless a lookup is running or the last one failed too recently. It must
+// be called with namespaceMu held.
+func (rc *responseCache) resolveNamespace() {
+	if rc.lookupNamespace == nil || rc.lookingUp || time.Now().Before(rc.nextLookup) {
+		return
+	}
+	rc.lookingUp = true
+	go func() {
+		namespace, err := rc.lookupNamespace()
+		rc.namespaceMu.Lock()
+		defer rc.namespaceMu.Unlock()
+		rc.lookingUp = false
+		if err != nil {
+			rc.lookupFailures++
+			wait := namespaceRetry.delay(rc.lookupFailures)
+			rc.nextLookup = time.Now().Add(wait)
+			log.Debug("Disk cache skipped, the node's network is not known", "error", err, "retry", wait)
+			return
+		}
+		rc.namespace = namespace
+	}()
+}
+
+// insert keeps result in memory under key for ttl, or until evicted if ttl
+// is 0.
+func (rc *responseCache) insert(key string, result json.RawMessage, ttl time.Duration) {
+	e := &cacheEntry{key: key, result: result}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[key]; ok {
+		rc.remove(el)
+	}
+	rc.entries[key] = rc.lru.PushFront(e)
+	if ttl == 0 {
+		rc.final++
+	}
+	for rc.lru.Len() > rc.config.Size {
+		rc.remove(rc.lru.Back())
+		rc.stats.Evictions++
+		metrics.Inc("rpc_cache_evictions_total")
+	}
+}
+
+// remove drops el. It must be called with mu held.
+func (rc *responseCache) remove(el *list.Element) {
+	e := rc.lru.Remove(el).(*cacheEntry)
+	delete(rc.entries, e.key)
+	if e.expires.IsZero() {
+		rc.final--
+	}
+}
+
+// Stats returns a snapshot of the cache.
+func (rc *responseCache) Stats() CacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	stats := rc.stats
+	stats.Entries = rc.lru.Len()
+	stats.Final = rc.final
+	stats.Size = rc.config.Size
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	if rc.config.Disk != nil {
+		disk := rc.config.Disk.Stats()
+		stats.Disk = &disk
+	}
+	return stats
+}
+
+// cachedMethod returns the catalog entry of the method name, or false if
+// its results are not cached.
+func cachedMethod(name string) (Method, bool) {
+	methods, err := GetMethods()
+	if err != nil {
+		return Method{}, false
+	}
+	for _, m := range methods {
+		if m.Name == name {
+			return m, m.Cache != ""
+		}
+	}
+	return Method{}, false
+}
+
+// cacheKey returns the key of a call, or "" if it is not cached. Calls are
+// keyed on their params exactly as sent: the catalog defaults need not be
+// those of the node, so a call that leaves a param out does not share an
+// entry with one that spells it out.
+func (c *Client) cacheKey(method string, params []interface{}) (string, Method) {
+	if c.cache == nil {
+		return "", Method{}
+	}
+	m, ok := cachedMethod(method)
+	if !ok {
+		return "", Method{}
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", Method{}
+	}
+	return method + string(data), m
+}
+
+// storeResult caches the result of a call keyed by key, for as long as its
+// confirmation depth allows. Errors and null results are not cached.
+func (c *Client) storeResult(ctx context.Context, key string, m Method, params []interface{}, result json.RawMessage) {
+	if string(result) == "null" {
+		return
+	}
+	ttl := c.cache.config.TipTTL
+	if depth, ok := c.resultDepth(ctx, m, params, result); ok && depth >= c.cache.config.FinalDepth {
+		ttl = 0
+	}
+	c.cache.put(key, result, ttl)
+}
+
+// resultDepth returns how many blocks deep the result of a call lies.
+func (c *Client) resultDepth(ctx context.Context, m Method, params []interface{}, result json.RawMessage) (uint64, bool) {
+	switch m.Cache {
+	case CacheOrder:
+		if len(params) == 0 {
+			return 0, false
+		}
+		// params are Go values or coerced tool arguments; their JSON form
+		// is what the node sees
+		var order uint64
+		data, err := json.Marshal(params[0])
+		if err != nil || json.Unmarshal(data, &order) != nil {
+			return 0, false
+		}
+		count, err := c.cachedBlockCount(ctx)
+		if err != nil || count <= order {
+			return 0, false
+		}
+		return count - 1 - order, true
+	case CacheConfirmations:
+		var v struct {
+			Confirmations *int64 `json:"confirmations"`
+		}
+		if json.Unmarshal(result, &v) != nil || v.Confirmations == nil || *v.Confirmations < 0 {
+			return 0, false
+		}
+		return uint64(*v.Confirmations), true
+	}
+	return 0, false
+}
+
+// cachedBlockCount returns the block count, fetching it at most once per
+// TipTTL.
+func (c *Client) cachedBlockCount(ctx context.Context) (uint64, error) {
+	rc := c.cache
+	rc.mu.Lock()
+	if !rc.countAt.IsZero() && time.Since(rc.countAt) < rc.config.TipTTL {
+		count := rc.count
+		rc.mu.Unlock()
+		return count, nil
+	}
+	rc.mu.Unlock()
+	count, err := c.GetBlockCount(ctx)
+	if err != nil {
+		log.Debug("Cannot measure the depth of a cached result", "error", err)
+		return 0, err
+	}
+	rc.mu.Lock()
+	rc.count, rc.countAt = count, time.Now()
+	rc.mu.Unlock()
+	return count, nil
+}
+
+// cachedResponse returns a response body carrying a cached result.
+func cachedResponse(id uint64, result json.RawMessage) ([]byte, error) {
+	return json.Marshal(JSONRPCResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// CacheStats returns a snapshot of the response cache, or nil if the
+// client has none.
+func (c *Client) CacheStats() *CacheStats {
+	if c.cache == nil {
+		return nil
+	}
+	stats := c.cache.Stats()
+	return &stats
+}
+
+// handleCacheResource serves the qng://cache resource.
+func (s *MCPServer) handleCacheResource(
+	ctx context.Context,
+	request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	stats := s.rpc.CacheStats()
+	if stats == nil {
+		return nil, fmt.Errorf("the response cache is disabled")
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newChainNode serves a chain of 100 blocks. Blocks echo their order,
+// transactions report as many confirmations as their hash says, and order
+// 999 does not exist. It counts the requests per method.
+func newChainNode(t *testing.T) (*httptest.Server, func(method string) int) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	srv := newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		mu.Lock()
+		calls[method]++
+		mu.Unlock()
+		switch method {
+		case "qng_getBlockCount":
+			return 100, nil
+		case "qng_getBlockByOrder":
+			if params[0].(float64) == 999 {
+				return nil, &RPCError{Code: -5, Message: "Block not found"}
+			}
+			return map[string]interface{}{"order": params[0]}, nil
+		case "qng_getRawTransaction":
+			var confirmations int
+			json.Unmarshal([]byte(params[0].(string)[:2]), &confirmations)
+			return map[string]interface{}{"confirmations": confirmations}, nil
+		}
+		return nil, nil
+	})
+	return srv, func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[method]
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	srv, calls := newChainNode(t)
+	c := NewClient(srv.URL, WithCache(CacheConfig{Size: 4, FinalDepth: 10, TipTTL: 50 * time.Millisecond}))
+	ctx := context.Background()
+	hits := metrics.Get("rpc_cache_hits_total", "method", "qng_getBlockByOrder")
+
+	// deep blocks are final
+	for i := 0; i < 2; i++ {
+		if block, err := c.GetBlockByOrder(ctx, 10); err != nil || block.Order != 10 {
+			t.Fatalf("Expected block 10, got %+v, %v", block, err)
+		}
+	}
+	body, err := c.CallRaw(ctx, "qng_getBlockByOrder", []interface{}{10, true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := decodeResponse(body); err != nil || string(result) != `{"order":10}` {
+		t.Errorf("Expected the cached block, got %s, %v", body, err)
+	}
+	if calls("qng_getBlockByOrder") != 1 || calls("qng_getBlockCount") != 1 {
+		t.Errorf("Expected one block and one block count request, got %d and %d", calls("qng_getBlockByOrder"), calls("qng_getBlockCount"))
+	}
+	if n := metrics.Get("rpc_cache_hits_total", "method", "qng_getBlockByOrder") - hits; n != 2 {
+		t.Errorf("Expected 2 counted hits, got %d", n)
+	}
+
+	// blocks near the tip expire
+	c.GetBlockByOrder(ctx, 95)
+	c.GetBlockByOrder(ctx, 95)
+	if calls("qng_getBlockByOrder") != 2 {
+		t.Errorf("Expected a tip block to be reused within its TTL, got %d requests", calls("qng_getBlockByOrder"))
+	}
+	time.Sleep(60 * time.Millisecond)
+	c.GetBlockByOrder(ctx, 95)
+	if calls("qng_getBlockByOrder") != 3 {
+		t.Errorf("Expected a tip block to expire, got %d requests", calls("qng_getBlockByOrder"))
+	}
+
+	// confirmations decide for transactions
+	for _, hash := range []string{"03aa", "03aa", "50aa", "50aa"} {
+		if err := c.Call(ctx, "qng_getRawTransaction", []interface{}{hash, true}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	c.Call(ctx, "qng_getRawTransaction", []interface{}{"03aa", true}, nil)
+	c.Call(ctx, "qng_getRawTransaction", []interface{}{"50aa", true}, nil)
+	if n := calls("qng_getRawTransaction"); n != 3 {
+		t.Errorf("Expected only the unconfirmed transaction to be fetched again, got %d requests", n)
+	}
+
+	// errors are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetBlockByOrder(ctx, 999); err == nil {
+			t.Fatal("Expected an error for a missing block")
+		}
+	}
+	if calls("qng_getBlockByOrder") != 5 {
+		t.Errorf("Expected errors to reach the node every time, got %d requests", calls("qng_getBlockByOrder"))
+	}
+
+	// a fifth result evicts the least recently used one, block 10
+	c.GetBlockByOrder(ctx, 20)
+	c.GetBlockByOrder(ctx, 10)
+	if calls("qng_getBlockByOrder") != 7 {
+		t.Errorf("Expected the least recently used block to be evicted, got %d requests", calls("qng_getBlockByOrder"))
+	}
+
+	stats := c.CacheStats()
+	if stats.Entries != 4 || stats.Evictions == 0 || stats.Hits == 0 || stats.Misses == 0 || stats.HitRate <= 0 {
+		t.Errorf("Unexpected cache stats %+v", stats)
+	}
+	if NewClient(srv.URL).CacheStats() != nil || c.WithEndpoint(srv.URL).cache != nil {
+		t.Error("Expected caching to be off unless configured")
+	}
+}
+
+func TestResponseCacheBatch(t *testing.T) {
+	srv, calls := newChainNode(t)
+	c := NewClient(srv.URL, WithCache(CacheConfig{Size: 10, FinalDepth: 10, TipTTL: time.Minute}))
+	ctx := context.Background()
+	if _, err := c.GetBlockByOrder(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := c.CallBatch(ctx, []BatchCall{
+		{Method: "qng_getBlockByOrder", Params: []interface{}{1, true}},
+		{Method: "qng_getBlockByOrder", Params: []interface{}{2, true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{`{"order":1}`, `{"order":2}`} {
+		if results[i].Err != nil || string(results[i].Result) != want {
+			t.Errorf("Result %d: expected %s, got %s, %v", i, want, results[i].Result, results[i].Err)
+		}
+	}
+	if n := calls("qng_getBlockByOrder"); n != 2 {
+		t.Errorf("Expected the cached block to be left out of the batch, got %d requests", n)
+	}
+
+	results, err = c.CallBatch(ctx, []BatchCall{{Method: "qng_getBlockByOrder", Params: []interface{}{2, true}}})
+	if err != nil || string(results[0].Result) != `{"order":2}` || calls("qng_getBlockByOrder") != 2 {
+		t.Errorf("Expected a batch of cached blocks not to reach the node, got %v, %v", results, err)
+	}
+
+	// the node fills in left out params, which need not match the catalog
+	// defaults
+	if _, err := c.CallRaw(ctx, "qng_getBlockByOrder", []interface{}{2}); err != nil || calls("qng_getBlockByOrder") != 3 {
+		t.Errorf("Expected a call with fewer params not to share an entry, got %d requests, %v", calls("qng_getBlockByOrder"), err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// methodNotificationCancelled is sent by a client to abandon a request.
+const methodNotificationCancelled = "notifications/cancelled"
+
+// requestIDArg is the argument under which the before-call hook hands the
+// JSON-RPC request ID to the tool middleware. It never reaches a handler.
+const requestIDArg = "_qng_mcp_request_id"
+
+// inflightKey identifies a tool call across sessions.
+type inflightKey struct {
+	session string
+	id      string
+}
+
+// inflightCalls gives every tool call its own context and cancels it when
+// the client sends notifications/cancelled for the call or its session
+// goes away. The context the transport hands to a handler cannot be used for
+// this: over SSE it ends as soon as the request has been accepted.
+//
+// The stdio transport reads the next message only after the current call
+// returns, so there a call is bounded by its timeout alone.
+type inflightCalls struct {
+	mu    sync.Mutex
+	calls map[inflightKey]context.CancelFunc
+}
+
+func newInflightCalls() *inflightCalls {
+	return &inflightCalls{calls: make(map[inflightKey]context.CancelFunc)}
+}
+
+// register wires the tracker into the server options.
+func (f *inflightCalls) register(hooks *server.Hooks) server.ServerOption {
+	hooks.AddBeforeCallTool(f.beforeCallTool)
+	hooks.AddOnUnregisterSession(f.onUnregisterSession)
+	return server.WithToolHandlerMiddleware(f.middleware)
+}
+
+// beforeCallTool passes the request ID on to middleware.
+func (f *inflightCalls) beforeCallTool(ctx context.Context, id any, message *mcp.CallToolRequest) {
+	if message.Params.Arguments == nil {
+		message.Params.Arguments = make(map[string]interface{})
+	}
+	message.Params.Arguments[requestIDArg] = id
+}
+
+// middleware runs next with a context that is cancelled by cancel or
+// onUnregisterSession.
+func (f *inflightCalls) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, ok := request.Params.Arguments[requestIDArg]
+		delete(request.Params.Arguments, requestIDArg)
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		if ok {
+			key := inflightKey{session: sessionID(ctx), id: fmt.Sprint(id)}
+			f.mu.Lock()
+			f.calls[key] = cancel
+			f.mu.Unlock()
+			defer func() {
+				f.mu.Lock()
+				delete(f.calls, key)
+				f.mu.Unlock()
+			}()
+		}
+		return next(ctx, request)
+	}
+}
+
+// handleCancelled handles notifications/cancelled.
+func (f *inflightCalls) handleCancelled(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+	key := inflightKey{session: sessionID(ctx), id: fmt.Sprint(id)}
+	f.mu.Lock()
+	cancel, ok := f.calls[key]
+	f.mu.Unlock()
+	if ok {
+		log.Debug("Cancelling tool call", "session", key.session, "id", key.id, "reason", notification.Params.AdditionalFields["reason"])
+		cancel()
+	}
+}
+
+// onUnregisterSession cancels the calls of a client that disconnected.
+func (f *inflightCalls) onUnregisterSession(ctx context.Context, session server.ClientSession) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, cancel := range f.calls {
+		if key.session == session.SessionID() {
+			log.Debug("Cancelling tool call of closed session", "session", key.session, "id", key.id)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newHangingNode starts a node that never answers and reports on the
+// returned channel when a request it holds is torn down.
+func newHangingNode(t *testing.T) (*httptest.Server, <-chan struct{}, *int32) {
+	t.Helper()
+	torn := make(chan struct{}, 10)
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		// the server notices a closed connection once the body is read
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			torn <- struct{}{}
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, torn, &hits
+}
+
+func waitTorn(t *testing.T, torn <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-torn:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the upstream request to be torn down")
+	}
+}
+
+func TestCallCancel(t *testing.T) {
+	node, torn, hits := newHangingNode(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewClient(node.URL).CallRaw(ctx, "qng_getNodeInfo", nil)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	waitTorn(t, torn)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("Expected a cancelled request not to be retried, got %d attempts", n)
+	}
+}
+
+func TestCancelledNotification(t *testing.T) {
+	node, torn, _ := newHangingNode(t)
+	s := NewMCPServer(NewClient(node.URL))
+	session := newTestSession("cancel-test")
+	if err := s.server.RegisterSession(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	ctx := s.server.WithContext(context.Background(), session)
+
+	call := func(id int) <-chan mcp.JSONRPCMessage {
+		done := make(chan mcp.JSONRPCMessage, 1)
+		msg, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": "get_node_info", "arguments": map[string]interface{}{}},
+		})
+		go func() { done <- s.server.HandleMessage(ctx, msg) }()
+		return done
+	}
+	returned := func(done <-chan mcp.JSONRPCMessage) {
+		t.Helper()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the cancelled tool call to return")
+		}
+	}
+
+	// the client abandons request 7
+	done := call(7)
+	time.Sleep(50 * time.Millisecond)
+	cancelMsg := []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user abort"}}`)
+	s.server.HandleMessage(ctx, cancelMsg)
+	waitTorn(t, torn)
+	returned(done)
+
+	// the client goes away while request 8 is running
+	done = call(8)
+	time.Sleep(50 * time.Millisecond)
+	s.server.UnregisterSession(context.Background(), session.SessionID())
+	waitTorn(t, torn)
+	returned(done)
+}
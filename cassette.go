@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Qitmeer/qng/log"
+)
+
+// Cassette records the JSON-RPC traffic of a client to a file, or replays
+// it from one without contacting a node. A cassette file holds one JSON
+// object per line with a request, its response and the network of the
+// endpoint that answered, so one cassette serves several networks. Requests
+// are stored without their ids, so a replayed response matches whatever id
+// the request carries, and a request made several times gets the responses
+// in the order they were recorded, then the last one again. Responses are
+// stored as compact JSON, so replayed results lose the node's whitespace.
+// It is safe for concurrent use.
+type Cassette struct {
+	path string
+
+	mu sync.Mutex
+	// file is the cassette being recorded, nil when replaying.
+	file *os.File
+	// responses holds the recorded responses by request and next the
+	// index of the response each request gets next.
+	responses map[string][]json.RawMessage
+	next      map[string]int
+}
+
+// cassetteInteraction is a line of a cassette file.
+type cassetteInteraction struct {
+	Network  string          `json:"network,omitempty"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// cassetteCall is a request as stored in a cassette.
+type cassetteCall struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+}
+
+// RecordCassette starts recording to a new cassette at path, replacing any
+// file there.
+func RecordCassette(path string) (*Cassette, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Cassette{path: path, file: f}, nil
+}
+
+// ReplayCassette loads the cassette at path for replay.
+func ReplayCassette(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := &Cassette{
+		path:      path,
+		responses: make(map[string][]json.RawMessage),
+		next:      make(map[string]int),
+	}
+	dec := json.NewDecoder(f)
+	for line := 1; ; line++ {
+		var interaction cassetteInteraction
+		err := dec.Decode(&interaction)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s: interaction %d: %v", path, line, err)
+		}
+		var key bytes.Buffer
+		if err := json.Compact(&key, interaction.Request); err != nil {
+			return nil, fmt.Errorf("cassette %s: interaction %d: %v", path, line, err)
+		}
+		k := interaction.Network + " " + key.String()
+		c.responses[k] = append(c.responses[k], interaction.Response)
+	}
+	return c, nil
+}
+
+// WithCassette records the traffic of the client to cassette, or replays
+// it from there.
+func WithCassette(cassette *Cassette) ClientOption {
+	return func(c *Client) {
+		c.cassette = cassette
+	}
+}
+
+// Replaying reports whether responses come from the cassette rather than a
+// node.
+func (c *Cassette) Replaying() bool {
+	return c.file == nil
+}
+
+// cassetteMissError is returned when replaying a request that the cassette
+// did not record.
+type cassetteMissError struct {
+	Path    string
+	Request string
+}
+
+func (e *cassetteMissError) Error() string {
+	return fmt.Sprintf("request not recorded in cassette %s: %s", e.Path, e.Request)
+}
+
+// isCassetteMiss reports whether err is a request the replayed cassette did
+// not record.
+func isCassetteMiss(err error) bool {
+	var miss *cassetteMissError
+	return errors.As(err, &miss)
+}
+
+// replay returns the next response recorded for requestBody on network,
+// carrying its ids.
+func (c *Cassette) replay(network string, requestBody []byte) ([]byte, error) {
+	request, ids, err := cassetteRequest(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	key := network + " " + request
+	c.mu.Lock()
+	responses := c.responses[key]
+	if len(responses) == 0 {
+		c.mu.Unlock()
+		return nil, &cassetteMissError{Path: c.path, Request: request}
+	}
+	i := c.next[key]
+	if i < len(responses)-1 {
+		c.next[key] = i + 1
+	}
+	c.mu.Unlock()
+	return withResponseIDs(responses[i], func(index uint64) (uint64, bool) {
+		if index >= uint64(len(ids)) {
+			return 0, false
+		}
+		return ids[index], true
+	})
+}
+
+// record appends requestBody and its response on network to the cassette.
+// Responses are stored with the position of their request in place of its
+// id.
+func (c *Cassette) record(network string, requestBody, body []byte) {
+	key, ids, err := cassetteRequest(requestBody)
+	if err == nil {
+		index := make(map[uint64]uint64, len(ids))
+		for i, id := range ids {
+			index[id] = uint64(i)
+		}
+		body, err = withResponseIDs(body, func(id uint64) (uint64, bool) {
+			i, ok := index[id]
+			return i, ok
+		})
+	}
+	if err != nil {
+		log.Warn("Cannot record request", "cassette", c.path, "error", err)
+		return
+	}
+	line, err := json.Marshal(cassetteInteraction{Network: network, Request: json.RawMessage(key), Response: body})
+	if err != nil {
+		log.Warn("Cannot record request", "cassette", c.path, "error", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		log.Warn("Cannot record request", "cassette", c.path, "error", err)
+	}
+}
+
+// Close stops recording.
+func (c *Cassette) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+// cassetteRequest returns the key of a request or batch, which leaves out
+// the ids and spells params canonically, and the ids in request order.
+func cassetteRequest(requestBody []byte) (string, []uint64, error) {
+	type request struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		ID     uint64          `json:"id"`
+	}
+	var requests []request
+	trimmed := bytes.TrimSpace(requestBody)
+	batch := len(trimmed) > 0 && trimmed[0] == '['
+	var err error
+	if batch {
+		err = json.Unmarshal(requestBody, &requests)
+	} else {
+		requests = make([]request, 1)
+		err = json.Unmarshal(requestBody, &requests[0])
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	calls := make([]cassetteCall, len(requests))
+	ids := make([]uint64, len(requests))
+	for i, r := range requests {
+		calls[i].Method = r.Method
+		ids[i] = r.ID
+		if len(r.Params) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(r.Params))
+			dec.UseNumber()
+			if err := dec.Decode(&calls[i].Params); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	var key []byte
+	if batch {
+		key, err = json.Marshal(calls)
+	} else {
+		key, err = json.Marshal(calls[0])
+	}
+	return string(key), ids, err
+}
+
+// withResponseIDs returns the response or batch of responses body with
+// every id replaced by mapID. It fails if an id cannot be mapped.
+func withResponseIDs(body []byte, mapID func(uint64) (uint64, bool)) ([]byte, error) {
+	var responses []JSONRPCResponse
+	trimmed := bytes.TrimSpace(body)
+	batch := len(trimmed) > 0 && trimmed[0] == '['
+	var err error
+	if batch {
+		err = json.Unmarshal(body, &responses)
+	} else {
+		responses = make([]JSONRPCResponse, 1)
+		err = json.Unmarshal(body, &responses[0])
+	}
+	if err != nil {
+		return nil, &invalidResponseError{err}
+	}
+	for i := range responses {
+		id, ok := mapID(responses[i].ID)
+		if !ok {
+			return nil, &invalidResponseError{errors.New("response to an unknown request id")}
+		}
+		responses[i].ID = id
+	}
+	if batch {
+		return json.Marshal(responses)
+	}
+	return json.Marshal(responses[0])
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCassette(t *testing.T) {
+	var count int64
+	node := newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		switch method {
+		case "qng_getBlockCount":
+			return atomic.AddInt64(&count, 1), nil
+		case "qng_getNodeInfo":
+			return map[string]interface{}{"params": params}, nil
+		}
+		return nil, &RPCError{Code: rpcCodeMethodNotFound, Message: "Method not found"}
+	})
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	ctx := context.Background()
+
+	rec, err := RecordCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(node.URL, WithCassette(rec))
+	var recorded []string
+	for i := 0; i < 2; i++ {
+		var raw json.RawMessage
+		if err := c.Call(ctx, "qng_getBlockCount", nil, &raw); err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, string(raw))
+	}
+	batch, err := c.CallBatch(ctx, []BatchCall{{Method: "qng_getNodeInfo", Params: []interface{}{1}}, {Method: "qng_getBlockCount"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result interface{}
+	if err := c.Call(ctx, "qng_unknown", nil, &result); err == nil {
+		t.Fatal("Expected an RPC error")
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	node.Close()
+
+	play, err := ReplayCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !play.Replaying() {
+		t.Fatal("Expected a loaded cassette to replay")
+	}
+	c = NewClient(node.URL, WithCassette(play))
+	// the node is gone, every answer comes from the cassette in order,
+	// then the last one again
+	for _, want := range append(recorded, recorded[1]) {
+		var raw json.RawMessage
+		if err := c.Call(ctx, "qng_getBlockCount", nil, &raw); err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != want {
+			t.Errorf("Expected replayed block count %s, got %s", want, raw)
+		}
+	}
+	replayed, err := c.CallBatch(ctx, []BatchCall{{Method: "qng_getNodeInfo", Params: []interface{}{1}}, {Method: "qng_getBlockCount"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range batch {
+		if string(replayed[i].Result) != string(batch[i].Result) {
+			t.Errorf("Expected batch result %d to be %s, got %s", i, batch[i].Result, replayed[i].Result)
+		}
+	}
+	err = c.Call(ctx, "qng_unknown", nil, &result)
+	if toolErr := asToolError("qng_unknown", err); toolErr.Kind != ErrorRPC {
+		t.Errorf("Expected the recorded RPC error, got %+v", toolErr)
+	}
+
+	_, err = c.CallRaw(ctx, "qng_getNodeInfo", []interface{}{2})
+	if !isCassetteMiss(err) || classifyError(err, 0) != "" {
+		t.Fatalf("Expected a miss that is not retried, got %v", err)
+	}
+	if toolErr := asToolError("qng_getNodeInfo", err); toolErr.Kind != ErrorUpstream || toolErr.Hint == "" {
+		t.Errorf("Expected a miss to explain itself, got %+v", toolErr)
+	}
+}
+
+func TestCassetteRequest(t *testing.T) {
+	a, ids, err := cassetteRequest([]byte(`{"jsonrpc":"2.0","method":"m","params":[1, {"b":2,"a":1.50}],"id":7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := cassetteRequest([]byte(`{"id":9,"method":"m","params":[1,{"a":1.50,"b":2}],"jsonrpc":"2.0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b || len(ids) != 1 || ids[0] != 7 {
+		t.Errorf("Expected the same key without ids, got %s and %s, ids %v", a, b, ids)
+	}
+	var call cassetteCall
+	if err := json.Unmarshal([]byte(a), &call); err != nil || call.Method != "m" {
+		t.Errorf("Unexpected key %s: %v", a, err)
+	}
+	if _, _, err := cassetteRequest([]byte(`{`)); err == nil {
+		t.Error("Expected a malformed request to be rejected")
+	}
+}
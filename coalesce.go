@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// flightGroup coalesces identical concurrent requests of a Client: while a
+// request is in flight, callers sending the same method and params wait for
+// its response instead of reaching the node again. It is safe for
+// concurrent use.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a request in flight and the callers waiting for it.
+type flight struct {
+	done    chan struct{}
+	body    []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do returns the result of fn for key, calling fn only if no call for key is
+// in flight. fn runs with a context that keeps the values of the first
+// caller's ctx but is only cancelled once every waiter has given up, so
+// cancelling one waiter does not fail the others. shared reports whether
+// the result came from another caller's call.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) (body []byte, shared bool, err error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, shared := g.flights[key]
+	if shared {
+		f.waiters++
+	} else {
+		var flightCtx context.Context
+		f = &flight{done: make(chan struct{}), waiters: 1}
+		flightCtx, f.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		g.flights[key] = f
+		go func() {
+			f.body, f.err = fn(flightCtx)
+			g.mu.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mu.Unlock()
+			f.cancel()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.body, shared, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// nobody wants the response any more; later callers start
+			// afresh rather than joining a cancelled request
+			f.cancel()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
+
+// flightKey returns the key under which identical requests are coalesced.
+func flightKey(method string, params []interface{}) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return method + string(data), nil
+}
+
+// withResponseID returns body with its id replaced by id, so that callers
+// sharing a response each see the id of their own request.
+func withResponseID(body []byte, id uint64) []byte {
+	var resp JSONRPCResponse
+	if json.Unmarshal(body, &resp) != nil {
+		return body
+	}
+	resp.ID = id
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return data
+}
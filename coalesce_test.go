@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBlockingNode serves requests once release is closed and counts them.
+// cancelled counts the requests whose client went away first.
+func newBlockingNode(t *testing.T) (srv *httptest.Server, release chan struct{}, requests, cancelled *atomic.Int32) {
+	release = make(chan struct{})
+	requests, cancelled = new(atomic.Int32), new(atomic.Int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			cancelled.Add(1)
+			return
+		}
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage(`"root"`)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, release, requests, cancelled
+}
+
+// waitWaiters waits until n callers wait for the flights of c.
+func waitWaiters(t *testing.T, c *Client, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.flights.mu.Lock()
+		waiters := 0
+		for _, f := range c.flights.flights {
+			waiters += f.waiters
+		}
+		c.flights.mu.Unlock()
+		if waiters == n {
+			return
+		}
+	}
+	t.Fatalf("Expected %d waiting callers", n)
+}
+
+// waitRequests waits until n requests reached a node made by
+// newBlockingNode.
+func waitRequests(t *testing.T, requests *atomic.Int32, n int32) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if requests.Load() == n {
+			return
+		}
+	}
+	t.Fatalf("Expected %d requests to reach the node, got %d", n, requests.Load())
+}
+
+func TestCoalesceIdenticalCalls(t *testing.T) {
+	srv, release, requests, _ := newBlockingNode(t)
+	c := NewClient(srv.URL)
+	shared := metrics.Get("rpc_calls_shared_total", "method", "qng_getStateRoot")
+
+	var wg sync.WaitGroup
+	ids := make([]uint64, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, err := c.CallRaw(context.Background(), "qng_getStateRoot", []interface{}{7, true})
+			var resp JSONRPCResponse
+			if err != nil || json.Unmarshal(body, &resp) != nil || string(resp.Result) != `"root"` {
+				t.Errorf("Expected the shared result, got %s, %v", body, err)
+			}
+			ids[i] = resp.ID
+		}(i)
+	}
+	waitWaiters(t, c, 5)
+	// other params and other endpoints are not coalesced
+	other := make(chan error)
+	go func() {
+		_, err := c.CallRaw(context.Background(), "qng_getStateRoot", []interface{}{8, true})
+		other <- err
+	}()
+	go func() {
+		_, err := c.WithEndpoint(srv.URL+"/").CallRaw(context.Background(), "qng_getStateRoot", []interface{}{7, true})
+		other <- err
+	}()
+	waitWaiters(t, c, 7)
+	close(release)
+	wg.Wait()
+	<-other
+	<-other
+
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected 3 requests to reach the node, got %d", n)
+	}
+	seen := make(map[uint64]bool)
+	for _, id := range ids {
+		seen[id] = true
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected each caller to see its own request id, got %v", ids)
+	}
+	if n := metrics.Get("rpc_calls_shared_total", "method", "qng_getStateRoot") - shared; n != 4 {
+		t.Errorf("Expected 4 shared calls to be counted, got %d", n)
+	}
+}
+
+func TestCoalesceCancellation(t *testing.T) {
+	srv, release, requests, cancelled := newBlockingNode(t)
+	c := NewClient(srv.URL)
+
+	// the caller that started the request gives up, the other still gets
+	// the response
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.CallRaw(ctx, "qng_getBlockCount", nil)
+		first <- err
+	}()
+	waitWaiters(t, c, 1)
+	second := make(chan error)
+	go func() {
+		_, err := c.CallRaw(context.Background(), "qng_getBlockCount", nil)
+		second <- err
+	}()
+	waitWaiters(t, c, 2)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to give up, got %v", err)
+	}
+	waitWaiters(t, c, 1)
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("Expected the remaining caller to get the response, got %v", err)
+	}
+	if requests.Load() != 1 || cancelled.Load() != 0 {
+		t.Errorf("Expected one request that was not cancelled, got %d and %d cancelled", requests.Load(), cancelled.Load())
+	}
+
+	// once every caller gave up the request is cancelled
+	srv, _, requests, cancelled = newBlockingNode(t)
+	c = NewClient(srv.URL)
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		_, err := c.CallRaw(ctx, "qng_getBlockCount", nil)
+		first <- err
+	}()
+	waitWaiters(t, c, 1)
+	// cancelling before the request reached the node would leave nothing
+	// for the node to see cancelled
+	waitRequests(t, requests, 1)
+	cancel()
+	<-first
+	for deadline := time.Now().Add(5 * time.Second); cancelled.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if cancelled.Load() != 1 {
+		t.Error("Expected the request to be cancelled once nobody waits for it")
+	}
+}
@@ -1,19 +1,150 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+	"gopkg.in/yaml.v3"
 )
 
 // Method represents a method or property with its details.
 type Method struct {
-	Name   string `json:"name"`
-	Call   string `json:"call"`
-	Desc   string `json:"desc"`
-	Params int    `json:"params"`
+	Name   string `json:"name" yaml:"name"`
+	Call   string `json:"call" yaml:"call"`
+	Desc   string `json:"desc" yaml:"desc"`
+	Params Params `json:"params" yaml:"params"`
+	// Category is the toolset the method belongs to, see Categories.
+	Category string `json:"category,omitempty" yaml:"category,omitempty"`
+	// Internal methods back the built-in tools and are not exposed as
+	// catalog tools; they are listed for their retry policy.
+	Internal bool `json:"internal,omitempty" yaml:"internal,omitempty"`
+	// Timeout, MaxAttempts, Backoff and RetryOn override the global retry
+	// policy for this method, see RetryPolicy.
+	Timeout     Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	MaxAttempts int      `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	Backoff     *Backoff `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	RetryOn     []string `json:"retry_on,omitempty" yaml:"retry_on,omitempty"`
+	// Cache marks results that stop changing once deep enough below the
+	// tip and tells how their depth is found, see CacheOrder and
+	// CacheConfirmations. Results of other methods are never cached.
+	Cache string `json:"cache,omitempty" yaml:"cache,omitempty"`
+	// Expensive marks calls that cost the node much more than others. They
+	// draw on the expensive budget of the rate limit. "always" marks every
+	// call, the name of a boolean param the calls where it is true.
+	Expensive string `json:"expensive,omitempty" yaml:"expensive,omitempty"`
+	// Generic marks methods added by discovery without a documented
+	// schema; their "params" argument is sent to the node as is.
+	Generic bool `json:"-" yaml:"-"`
 }
 type QngMethods []Method
 
+// JSON types a catalog parameter may declare.
+const (
+	ParamString  = "string"
+	ParamNumber  = "number"
+	ParamInteger = "integer"
+	ParamBoolean = "boolean"
+	ParamArray   = "array"
+)
+
+// Param describes one positional parameter of a QNG RPC method. Params are
+// sent to the node in declaration order; a missing optional param is sent as
+// its default, or as null when it has none. Format optionally narrows Type,
+// see the Format* constants.
+type Param struct {
+	Name     string      `json:"name" yaml:"name"`
+	Type     string      `json:"type" yaml:"type"`
+	Format   string      `json:"format,omitempty" yaml:"format,omitempty"`
+	Desc     string      `json:"desc,omitempty" yaml:"desc,omitempty"`
+	Enum     []string    `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Default  interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	Required bool        `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// Params is the ordered parameter list of a method.
+type Params []Param
+
+// UnmarshalJSON accepts either a list of Param or, for catalogs written
+// before parameters were named, a bare parameter count.
+func (p *Params) UnmarshalJSON(data []byte) error {
+	var count int
+	if err := json.Unmarshal(data, &count); err == nil {
+		return p.setLegacy(count)
+	}
+	var list []Param
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// UnmarshalYAML is the YAML counterpart of UnmarshalJSON.
+func (p *Params) UnmarshalYAML(value *yaml.Node) error {
+	var count int
+	if value.Kind == yaml.ScalarNode && value.Decode(&count) == nil {
+		return p.setLegacy(count)
+	}
+	var list []Param
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// setLegacy turns a bare parameter count into required string params named
+// parameter0..parameterN-1.
+func (p *Params) setLegacy(count int) error {
+	if count < 0 {
+		return fmt.Errorf("negative params %d", count)
+	}
+	ps := make(Params, count)
+	for i := range ps {
+		ps[i] = Param{
+			Name:     fmt.Sprintf("parameter%d", i),
+			Type:     ParamString,
+			Desc:     fmt.Sprintf("Parameter %d of the method call.", i+1),
+			Required: true,
+		}
+	}
+	*p = ps
+	return nil
+}
+
+// validate checks a single parameter declaration.
+func (p Param) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	switch p.Type {
+	case ParamString, ParamNumber, ParamInteger, ParamBoolean, ParamArray:
+	default:
+		return fmt.Errorf("%s: unsupported type %q", p.Name, p.Type)
+	}
+	if err := validateFormat(p.Type, p.Format); err != nil {
+		return fmt.Errorf("%s: %v", p.Name, err)
+	}
+	if len(p.Enum) > 0 && p.Type != ParamString {
+		return fmt.Errorf("%s: enum is only supported for string params", p.Name)
+	}
+	if p.Required && p.Default != nil {
+		return fmt.Errorf("%s: a required param cannot have a default", p.Name)
+	}
+	return nil
+}
+
+// methodsCatalog holds the active method catalog. It is replaced as a whole
+// on reload so readers never observe a partially updated set.
+var methodsCatalog atomic.Pointer[QngMethods]
+
 func (m *QngMethods) FindName(call string) (Method, error) {
 	for _, v := range *m {
 		if v.Call == call {
@@ -23,10 +154,381 @@ func (m *QngMethods) FindName(call string) (Method, error) {
 	return Method{}, fmt.Errorf("method not found")
 }
 
-var methods QngMethods
+// Validate checks that every method has a name and a call, that calls are
+// unique (they become tool names) and that every parameter is well formed.
+func (m QngMethods) Validate() error {
+	if len(m) == 0 {
+		return fmt.Errorf("method catalog is empty")
+	}
+	seen := make(map[string]struct{}, len(m))
+	for i, v := range m {
+		if v.Name == "" {
+			return fmt.Errorf("method %d: missing name", i)
+		}
+		if v.Call == "" {
+			return fmt.Errorf("method %s: missing call", v.Name)
+		}
+		if _, ok := seen[v.Call]; ok {
+			return fmt.Errorf("method %s: duplicate call %q", v.Name, v.Call)
+		}
+		seen[v.Call] = struct{}{}
+		if v.Category != "" && !validCategory(v.Category) {
+			return fmt.Errorf("method %s: unknown category %q", v.Name, v.Category)
+		}
+		if err := v.validatePolicy(); err != nil {
+			return fmt.Errorf("method %s: %v", v.Name, err)
+		}
+		if _, ok := cacheModes[v.Cache]; v.Cache != "" && !ok {
+			return fmt.Errorf("method %s: unknown cache mode %q", v.Name, v.Cache)
+		}
+		if v.Cache == CacheOrder && (len(v.Params) == 0 || v.Params[0].Type != ParamInteger) {
+			return fmt.Errorf("method %s: cache mode order needs a block order as the first param", v.Name)
+		}
+		if err := v.validateExpensive(); err != nil {
+			return fmt.Errorf("method %s: %v", v.Name, err)
+		}
+		names := make(map[string]struct{}, len(v.Params))
+		for j, p := range v.Params {
+			if err := p.validate(); err != nil {
+				return fmt.Errorf("method %s: param %d: %v", v.Name, j, err)
+			}
+			if _, ok := names[p.Name]; ok {
+				return fmt.Errorf("method %s: duplicate param %q", v.Name, p.Name)
+			}
+			names[p.Name] = struct{}{}
+		}
+	}
+	return nil
+}
 
-// GetMethods parses the QngJs JSON and returns a slice of Method structs.
-// These methods are organized into categories for better AI model understanding:
+// QngMethodsJson is the built-in method catalog used when no --methods file
+// is configured.
+const QngMethodsJson = `{
+  "methods": [
+    {
+      "name": "qng_getBlockByOrder",
+      "call": "get_block_by_order",
+      "category": "block",
+      "desc": "Retrieves a block by its order. Backs the qng_get_block_by_order tool.",
+      "internal": true,
+      "timeout": "60s",
+      "cache": "order",
+      "expensive": "full_tx",
+      "params": [
+        {"name": "block_order", "type": "integer", "desc": "Block order.", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object.", "default": true},
+        {"name": "incl_tx", "type": "boolean", "desc": "Include the block's transactions.", "default": true},
+        {"name": "full_tx", "type": "boolean", "desc": "Return full transaction objects instead of transaction hashes.", "default": true}
+      ]
+    },
+    {
+      "name": "qng_getBlockCount",
+      "call": "get_block_count",
+      "category": "chain",
+      "desc": "Returns the number of blocks. Backs the qng_get_block_count tool.",
+      "internal": true,
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    },
+    {
+      "name": "qng_getStateRoot",
+      "call": "get_state_root",
+      "category": "block",
+      "desc": "Retrieves the state root of a block. Backs the qng_get_stateroot tool. This is the slowest query the node serves.",
+      "internal": true,
+      "timeout": "90s",
+      "max_attempts": 2,
+      "backoff": {"initial": "3s", "max": "30s", "multiplier": 2},
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "cache": "order",
+      "expensive": "always",
+      "params": [
+        {"name": "block_order", "type": "integer", "desc": "Block order.", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object.", "default": true}
+      ]
+    },
+    {
+      "name": "qng_getPeerInfo",
+      "call": "get_peer_info",
+      "category": "network",
+      "desc": "Retrieves detailed peer connection information from the QNG network. Returns data about connected peers including their addresses, connection status, and network statistics.",
+      "params": [
+        {"name": "verbose", "type": "boolean", "desc": "Include inactive peers as well as active ones.", "default": false},
+        {"name": "peer_id", "type": "string", "desc": "Only return the peer with this peer ID."}
+      ]
+    },
+    {
+      "name": "qng_getBlockWeight",
+      "call": "get_block_weight",
+      "category": "block",
+      "desc": "Retrieves the weight (difficulty) of a specific block in the QNG blockchain. Block weight is used in consensus algorithms to determine the chain with the most accumulated work.",
+      "params": [
+        {"name": "block_hash", "type": "string", "format": "hash", "desc": "Hash of the block (64 hex characters).", "required": true}
+      ]
+    },
+    {
+      "name": "qng_getBlockByID",
+      "call": "get_block_by_id",
+      "category": "block",
+      "desc": "Retrieves complete block information using the block's unique identifier (block hash). Returns full block data including header, transactions, and metadata.",
+      "timeout": "60s",
+      "cache": "confirmations",
+      "expensive": "full_tx",
+      "params": [
+        {"name": "block_id", "type": "integer", "format": "uint64", "desc": "Internal DAG block ID (non-negative integer).", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object instead of serialized hex.", "default": true},
+        {"name": "incl_tx", "type": "boolean", "desc": "Include the block's transactions.", "default": true},
+        {"name": "full_tx", "type": "boolean", "desc": "Return full transaction objects instead of transaction hashes.", "default": false}
+      ]
+    },
+    {
+      "name": "qng_getBlockByNum",
+      "call": "get_block_by_num",
+      "category": "block",
+      "desc": "Retrieves complete block information using the block number (height). Returns full block data including header, transactions, and metadata for the specified block height.",
+      "timeout": "60s",
+      "cache": "confirmations",
+      "expensive": "full_tx",
+      "params": [
+        {"name": "block_number", "type": "integer", "format": "uint64", "desc": "Main chain block number (non-negative integer).", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object instead of serialized hex.", "default": true},
+        {"name": "incl_tx", "type": "boolean", "desc": "Include the block's transactions.", "default": true},
+        {"name": "full_tx", "type": "boolean", "desc": "Return full transaction objects instead of transaction hashes.", "default": false}
+      ]
+    },
+    {
+      "name": "qng_isBlue",
+      "call": "is_blue",
+      "category": "block",
+      "desc": "Checks if a specific block is considered 'blue' in the QNG consensus algorithm. Blue blocks are part of the main chain and have been confirmed by the network.",
+      "params": [
+        {"name": "block_hash", "type": "string", "format": "hash", "desc": "Hash of the block to check (64 hex characters).", "required": true}
+      ]
+    },
+    {
+      "name": "qng_getCoinbase",
+      "call": "get_coinbase",
+      "category": "block",
+      "desc": "Retrieves coinbase transaction information for a specific block. The coinbase transaction is the first transaction in each block and contains the block reward.",
+      "params": [
+        {"name": "block_hash", "type": "string", "format": "hash", "desc": "Hash of the block (64 hex characters).", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object instead of serialized hex.", "default": false}
+      ]
+    },
+    {
+      "name": "qng_getFees",
+      "call": "get_fees",
+      "category": "block",
+      "desc": "Retrieves current network fee information including recommended transaction fees, fee rates, and fee estimation data for optimal transaction processing.",
+      "params": [
+        {"name": "block_hash", "type": "string", "format": "hash", "desc": "Hash of the block (64 hex characters).", "required": true}
+      ]
+    },
+    {
+      "name": "qng_getMempool",
+      "call": "get_mempool",
+      "category": "transaction",
+      "desc": "Retrieves information about transactions currently in the memory pool (mempool). Returns pending transactions waiting to be included in the next block.",
+      "timeout": "50s",
+      "params": [
+        {"name": "tx_type", "type": "string", "desc": "Only return transactions of this type. Leave empty for all types.", "default": ""},
+        {"name": "verbose", "type": "boolean", "desc": "Return transaction details instead of hashes.", "default": false}
+      ]
+    },
+    {
+      "name": "qng_estimateFee",
+      "call": "estimate_fee",
+      "category": "transaction",
+      "desc": "Estimates the appropriate transaction fee for a given transaction size or priority level. Helps users set optimal fees for timely transaction confirmation.",
+      "params": [
+        {"name": "num_blocks", "type": "integer", "desc": "Target number of blocks for the transaction to be confirmed within.", "required": true}
+      ]
+    },
+    {
+      "name": "qng_getBlockTemplate",
+      "call": "get_block_template",
+      "category": "mining",
+      "desc": "Retrieves a block template for mining operations. Returns the structure and data needed to construct a new block, including transaction selection and header information.",
+      "params": [
+        {"name": "capabilities", "type": "array", "desc": "Client capabilities, for example coinbasetxn or coinbasevalue.", "default": []},
+        {"name": "pow_type", "type": "integer", "desc": "Proof-of-work algorithm ID the template is built for.", "default": 8}
+      ]
+    },
+    {
+      "name": "qng_getRawTransaction",
+      "call": "get_raw_transaction",
+      "category": "transaction",
+      "desc": "Retrieves raw transaction data by transaction hash. Returns the complete transaction in its serialized format as it appears on the blockchain.",
+      "cache": "confirmations",
+      "params": [
+        {"name": "tx_hash", "type": "string", "format": "hash", "desc": "Transaction hash (64 hex characters).", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object instead of serialized hex.", "default": false}
+      ]
+    },
+    {
+      "name": "qng_getUtxo",
+      "call": "get_utxo",
+      "category": "transaction",
+      "desc": "Retrieves Unspent Transaction Output (UTXO) information for a specific address or transaction. UTXOs represent available funds that can be spent in new transactions.",
+      "params": [
+        {"name": "tx_hash", "type": "string", "format": "hash", "desc": "Transaction hash (64 hex characters).", "required": true},
+        {"name": "vout", "type": "integer", "format": "uint64", "desc": "Index of the output in the transaction.", "required": true},
+        {"name": "include_mempool", "type": "boolean", "desc": "Also consider unconfirmed transactions in the mempool.", "default": true}
+      ]
+    },
+    {
+      "name": "qng_getRawTransactions",
+      "call": "get_raw_transactions",
+      "category": "transaction",
+      "desc": "Retrieves multiple raw transactions based on various filtering criteria. Returns serialized transaction data for multiple transactions matching the specified parameters.",
+      "timeout": "50s",
+      "expensive": "always",
+      "params": [
+        {"name": "address", "type": "string", "desc": "QNG address whose transactions are listed.", "required": true},
+        {"name": "vin_extra", "type": "boolean", "desc": "Include previous output details for every input.", "default": false},
+        {"name": "count", "type": "integer", "format": "uint64", "desc": "Maximum number of transactions to return.", "default": 100},
+        {"name": "skip", "type": "integer", "format": "uint64", "desc": "Number of transactions to skip.", "default": 0},
+        {"name": "reverse", "type": "boolean", "desc": "Return the newest transactions first.", "default": false},
+        {"name": "verbose", "type": "boolean", "desc": "Return decoded transactions instead of serialized hex.", "default": true},
+        {"name": "filter_addrs", "type": "array", "desc": "Only include inputs and outputs involving these addresses."}
+      ]
+    },
+    {
+      "name": "qng_getRawTransactionByHash",
+      "call": "get_raw_transaction_by_hash",
+      "category": "transaction",
+      "desc": "Retrieves raw transaction data using the transaction hash as the lookup key. Returns the complete serialized transaction data for the specified transaction.",
+      "cache": "confirmations",
+      "params": [
+        {"name": "tx_hash", "type": "string", "format": "hash", "desc": "Transaction hash (64 hex characters).", "required": true},
+        {"name": "verbose", "type": "boolean", "desc": "Return a decoded JSON object instead of serialized hex.", "default": false}
+      ]
+    },
+    {
+      "name": "qng_getNodeInfo",
+      "call": "get_node_info",
+      "category": "node",
+      "desc": "Retrieves comprehensive information about the current QNG node including version, build information, network status, and configuration details.",
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    },
+    {
+      "name": "qng_getRpcInfo",
+      "call": "get_rpc_info",
+      "category": "node",
+      "desc": "Retrieves information about the RPC server configuration and status including available methods, connection details, and server statistics.",
+      "params": []
+    },
+    {
+      "name": "qng_getTimeInfo",
+      "call": "get_time_info",
+      "category": "node",
+      "desc": "Retrieves time-related information from the QNG node including current blockchain time, synchronization status, and time offset data.",
+      "params": []
+    },
+    {
+      "name": "qng_getNetworkInfo",
+      "call": "get_network_info",
+      "category": "network",
+      "desc": "Retrieves comprehensive network information including peer connections, network topology, bandwidth statistics, and network health metrics.",
+      "params": []
+    },
+    {
+      "name": "qng_getSubsidy",
+      "call": "get_subsidy",
+      "category": "mining",
+      "desc": "Retrieves current block subsidy information including mining rewards, emission rates, and subsidy schedule for the QNG blockchain.",
+      "params": []
+    },
+    {
+      "name": "qng_banlist",
+      "call": "banlist",
+      "category": "network",
+      "desc": "Retrieves the list of banned or blocked network peers. Returns information about peers that have been temporarily or permanently blocked from connecting to the node.",
+      "params": []
+    },
+    {
+      "name": "qng_getBestBlockHash",
+      "call": "get_best_block_hash",
+      "category": "chain",
+      "desc": "Retrieves the hash of the current best (highest) block in the blockchain. This represents the tip of the main chain and the most recent confirmed block.",
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    },
+    {
+      "name": "qng_getBlockTotal",
+      "call": "get_block_total",
+      "category": "chain",
+      "desc": "Retrieves the total number of blocks in the blockchain. Returns the current block count (height) representing the total blocks mined since genesis.",
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    },
+    {
+      "name": "qng_getMainChainHeight",
+      "call": "get_main_chain_height",
+      "category": "chain",
+      "desc": "Retrieves the height of the main blockchain. Returns the number of blocks in the longest valid chain, representing the current blockchain length.",
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    },
+    {
+      "name": "qng_getOrphansTotal",
+      "call": "get_orphans_total",
+      "category": "chain",
+      "desc": "Retrieves the total number of orphaned blocks in the blockchain. Orphaned blocks are valid blocks that are not part of the main chain due to chain reorganization.",
+      "params": []
+    },
+    {
+      "name": "qng_isCurrent",
+      "call": "is_current",
+      "category": "chain",
+      "desc": "Checks if the node is currently synchronized with the network. Returns whether the local blockchain is up-to-date with the latest blocks from the network.",
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    },
+    {
+      "name": "qng_tips",
+      "call": "tips",
+      "category": "chain",
+      "desc": "Retrieves information about blockchain tips (multiple potential chain heads). Returns data about competing chain branches and their respective weights.",
+      "params": []
+    },
+    {
+      "name": "qng_getTokenInfo",
+      "call": "get_token_info",
+      "category": "chain",
+      "desc": "Retrieves information about tokens and assets on the QNG blockchain including token metadata, supply information, and token contract details.",
+      "params": []
+    },
+    {
+      "name": "qng_getMempoolCount",
+      "call": "get_mempool_count",
+      "category": "transaction",
+      "desc": "Retrieves the current count of transactions in the memory pool. Returns the number of pending transactions waiting to be included in the next block.",
+      "timeout": "10s",
+      "max_attempts": 3,
+      "retry_on": ["timeout", "connection", "http_5xx", "http_429"],
+      "params": []
+    }
+  ]
+}`
+
+// GetMethods returns the active method catalog. Unless a catalog file has been
+// loaded with SetMethods, the built-in QngMethodsJson is parsed on first use.
+// These methods are organized into categories for better AI model understanding;
+// each method's Category names its toolset, see --toolsets:
 // - Block Operations: get_block_by_id, get_block_by_num, get_block_weight, etc.
 // - Transaction Operations: get_raw_transaction, get_raw_transactions, get_utxo, etc.
 // - Network Operations: get_peer_info, get_network_info, banlist, etc.
@@ -34,190 +536,96 @@ var methods QngMethods
 // - Mining Operations: get_block_template, get_subsidy, etc.
 // - Chain Operations: get_best_block_hash, get_block_total, is_current, etc.
 func GetMethods() (QngMethods, error) {
-	if len(methods) > 0 {
-		return methods, nil
-	}
-	const QngMethodsJson = `{
-	  "methods": [
-	    {
-	      "name": "qng_getPeerInfo",
-	      "call": "get_peer_info",
-	      "desc": "Retrieves detailed peer connection information from the QNG network. Returns data about connected peers including their addresses, connection status, and network statistics.",
-	      "params": 1
-	    },
-	    {
-	      "name": "qng_getBlockWeight",
-	      "call": "get_block_weight",
-	      "desc": "Retrieves the weight (difficulty) of a specific block in the QNG blockchain. Block weight is used in consensus algorithms to determine the chain with the most accumulated work.",
-	      "params": 1
-	    },
-	    {
-	      "name": "qng_getBlockByID",
-	      "call": "get_block_by_id",
-	      "desc": "Retrieves complete block information using the block's unique identifier (block hash). Returns full block data including header, transactions, and metadata.",
-	      "params": 4
-	    },
-	    {
-	      "name": "qng_getBlockByNum",
-	      "call": "get_block_by_num",
-	      "desc": "Retrieves complete block information using the block number (height). Returns full block data including header, transactions, and metadata for the specified block height.",
-	      "params": 4
-	    },
-	    {
-	      "name": "qng_isBlue",
-	      "call": "is_blue",
-	      "desc": "Checks if a specific block is considered 'blue' in the QNG consensus algorithm. Blue blocks are part of the main chain and have been confirmed by the network.",
-	      "params": 1
-	    },
-	    {
-	      "name": "qng_getCoinbase",
-	      "call": "get_coinbase",
-	      "desc": "Retrieves coinbase transaction information for a specific block. The coinbase transaction is the first transaction in each block and contains the block reward.",
-	      "params": 2
-	    },
-	    {
-	      "name": "qng_getFees",
-	      "call": "get_fees",
-	      "desc": "Retrieves current network fee information including recommended transaction fees, fee rates, and fee estimation data for optimal transaction processing.",
-	      "params": 1
-	    },
-	    {
-	      "name": "qng_getMempool",
-	      "call": "get_mempool",
-	      "desc": "Retrieves information about transactions currently in the memory pool (mempool). Returns pending transactions waiting to be included in the next block.",
-	      "params": 2
-	    },
-	    {
-	      "name": "qng_estimateFee",
-	      "call": "estimate_fee",
-	      "desc": "Estimates the appropriate transaction fee for a given transaction size or priority level. Helps users set optimal fees for timely transaction confirmation.",
-	      "params": 1
-	    },
-	    {
-	      "name": "qng_getBlockTemplate",
-	      "call": "get_block_template",
-	      "desc": "Retrieves a block template for mining operations. Returns the structure and data needed to construct a new block, including transaction selection and header information.",
-	      "params": 2
-	    },
-	    {
-	      "name": "qng_getRawTransaction",
-	      "call": "get_raw_transaction",
-	      "desc": "Retrieves raw transaction data by transaction hash. Returns the complete transaction in its serialized format as it appears on the blockchain.",
-	      "params": 2
-	    },
-	    {
-	      "name": "qng_getUtxo",
-	      "call": "get_utxo",
-	      "desc": "Retrieves Unspent Transaction Output (UTXO) information for a specific address or transaction. UTXOs represent available funds that can be spent in new transactions.",
-	      "params": 3
-	    },
-	    {
-	      "name": "qng_getRawTransactions",
-	      "call": "get_raw_transactions",
-	      "desc": "Retrieves multiple raw transactions based on various filtering criteria. Returns serialized transaction data for multiple transactions matching the specified parameters.",
-	      "params": 7
-	    },
-	    {
-	      "name": "qng_getRawTransactionByHash",
-	      "call": "get_raw_transaction_by_hash",
-	      "desc": "Retrieves raw transaction data using the transaction hash as the lookup key. Returns the complete serialized transaction data for the specified transaction.",
-	      "params": 2
-	    },
-	    {
-	      "name": "qng_getNodeInfo",
-	      "call": "get_node_info",
-	      "desc": "Retrieves comprehensive information about the current QNG node including version, build information, network status, and configuration details.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getRpcInfo",
-	      "call": "get_rpc_info",
-	      "desc": "Retrieves information about the RPC server configuration and status including available methods, connection details, and server statistics.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getTimeInfo",
-	      "call": "get_time_info",
-	      "desc": "Retrieves time-related information from the QNG node including current blockchain time, synchronization status, and time offset data.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getNetworkInfo",
-	      "call": "get_network_info",
-	      "desc": "Retrieves comprehensive network information including peer connections, network topology, bandwidth statistics, and network health metrics.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getSubsidy",
-	      "call": "get_subsidy",
-	      "desc": "Retrieves current block subsidy information including mining rewards, emission rates, and subsidy schedule for the QNG blockchain.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_banlist",
-	      "call": "banlist",
-	      "desc": "Retrieves the list of banned or blocked network peers. Returns information about peers that have been temporarily or permanently blocked from connecting to the node.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getBestBlockHash",
-	      "call": "get_best_block_hash",
-	      "desc": "Retrieves the hash of the current best (highest) block in the blockchain. This represents the tip of the main chain and the most recent confirmed block.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getBlockTotal",
-	      "call": "get_block_total",
-	      "desc": "Retrieves the total number of blocks in the blockchain. Returns the current block count (height) representing the total blocks mined since genesis.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getMainChainHeight",
-	      "call": "get_main_chain_height",
-	      "desc": "Retrieves the height of the main blockchain. Returns the number of blocks in the longest valid chain, representing the current blockchain length.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getOrphansTotal",
-	      "call": "get_orphans_total",
-	      "desc": "Retrieves the total number of orphaned blocks in the blockchain. Orphaned blocks are valid blocks that are not part of the main chain due to chain reorganization.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_isCurrent",
-	      "call": "is_current",
-	      "desc": "Checks if the node is currently synchronized with the network. Returns whether the local blockchain is up-to-date with the latest blocks from the network.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_tips",
-	      "call": "tips",
-	      "desc": "Retrieves information about blockchain tips (multiple potential chain heads). Returns data about competing chain branches and their respective weights.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getTokenInfo",
-	      "call": "get_token_info",
-	      "desc": "Retrieves information about tokens and assets on the QNG blockchain including token metadata, supply information, and token contract details.",
-	      "params": 0
-	    },
-	    {
-	      "name": "qng_getMempoolCount",
-	      "call": "get_mempool_count",
-	      "desc": "Retrieves the current count of transactions in the memory pool. Returns the number of pending transactions waiting to be included in the next block.",
-	      "params": 0
-	    }
-	  ]
-	}`
-
-	var data struct {
-		Methods []Method `json:"methods"`
-	}
-
-	err := json.Unmarshal([]byte(QngMethodsJson), &data)
+	if m := methodsCatalog.Load(); m != nil {
+		return *m, nil
+	}
+	m, err := ParseMethods([]byte(QngMethodsJson), ".json")
+	if err != nil {
+		return nil, err
+	}
+	methodsCatalog.CompareAndSwap(nil, &m)
+	return *methodsCatalog.Load(), nil
+}
+
+// ParseMethods decodes a method catalog of the form {"methods": [...]}.
+// YAML is used when ext is .yaml or .yml, JSON otherwise. The result is
+// validated before it is returned.
+func ParseMethods(data []byte, ext string) (QngMethods, error) {
+	var catalog struct {
+		Methods QngMethods `json:"methods" yaml:"methods"`
+	}
+	var err error
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &catalog)
+	default:
+		err = json.Unmarshal(data, &catalog)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing method catalog: %v", err)
+	}
+	if err := catalog.Methods.Validate(); err != nil {
+		return nil, err
+	}
+	return catalog.Methods, nil
+}
+
+// LoadMethodsFile reads and validates the method catalog stored at path.
+func LoadMethodsFile(path string) (QngMethods, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %v", err)
+		return nil, err
+	}
+	return ParseMethods(data, filepath.Ext(path))
+}
+
+// SetMethods validates m and atomically makes it the active catalog.
+func SetMethods(m QngMethods) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	methodsCatalog.Store(&m)
+	return nil
+}
+
+// WatchMethodsFile polls path every interval and reloads the catalog when the
+// file's size or modification time changes. A catalog that fails to load or
+// validate is logged and ignored so the previous one stays active. onChange
+// is invoked after every successful swap. It returns when ctx is done.
+func WatchMethodsFile(ctx context.Context, path string, interval time.Duration, onChange func(QngMethods)) {
+	var lastMod time.Time
+	var lastSize int64
+	if fi, err := os.Stat(path); err == nil {
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Warn("Cannot stat method catalog", "path", path, "error", err)
+			continue
+		}
+		if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+		m, err := LoadMethodsFile(path)
+		if err == nil {
+			err = SetMethods(m)
+		}
+		if err != nil {
+			log.Warn("Ignoring invalid method catalog", "path", path, "error", err)
+			continue
+		}
+		log.Info("Reloaded method catalog", "path", path, "methods", len(m))
+		if onChange != nil {
+			onChange(m)
+		}
 	}
-	methods = data.Methods
-	return methods, nil
 }
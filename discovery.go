@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Qitmeer/qng/log"
+)
+
+// DiscoveryReport describes what startup discovery found on the node and
+// how the catalog was adjusted.
+type DiscoveryReport struct {
+	Endpoint string    `json:"endpoint"`
+	Time     time.Time `json:"time"`
+	// Modules maps an RPC namespace to whether the node enables it.
+	Modules map[string]bool `json:"modules,omitempty"`
+	// Available lists catalog methods the node answered.
+	Available []string `json:"available"`
+	// Hidden lists catalog methods the node lacks; they are not exposed.
+	Hidden []string `json:"hidden"`
+	// Unknown lists methods the node reported that the catalog does not
+	// describe; they are exposed with a generic schema.
+	Unknown []string `json:"unknown"`
+	// Errors collects probes that failed for other reasons. Those methods
+	// are kept.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// discoveryState keeps the last report for the diagnostic tool.
+var discoveryState struct {
+	sync.RWMutex
+	report *DiscoveryReport
+}
+
+// probeResult classifies the outcome of a single RPC probe.
+type probeResult int
+
+const (
+	probeOK probeResult = iota
+	probeMissing
+	probeFailed
+)
+
+// discoveryProbe is the retry policy of discovery probes: a single short
+// attempt, whatever the catalog says about the method. The methods of a
+// node too slow to answer are kept.
+var discoveryProbe = RetryPolicy{Timeout: 5 * time.Second, MaxAttempts: 1}
+
+// probe calls method with params. Any answer other than "method not found"
+// proves the node serves it, including invalid-params errors.
+func probe(ctx context.Context, c *Client, method string, params []interface{}) (json.RawMessage, probeResult, error) {
+	body, err := c.CallRaw(ctx, method, params)
+	if err != nil {
+		return nil, probeFailed, err
+	}
+	result, err := decodeResponse(body)
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr) && rpcErr.Code == rpcCodeMethodNotFound:
+		return nil, probeMissing, nil
+	case rpcErr != nil:
+		return nil, probeOK, nil
+	case err != nil:
+		return nil, probeFailed, err
+	}
+	return result, probeOK, nil
+}
+
+// probeParams are params the node rejects as invalid before calling m: one
+// more than m takes, each an empty object. A node without m answers "method
+// not found" instead, so the probe tells the two apart without making the
+// node do any work, such as building a block template. Methods without
+// params are plain getters, which the node calls regardless.
+func probeParams(m Method) []interface{} {
+	params := make([]interface{}, len(m.Params)+1)
+	for i := range params {
+		params[i] = map[string]interface{}{}
+	}
+	return params
+}
+
+// probeModules asks the node which RPC namespaces it enables, trying the
+// generic rpc_modules first and QNG's qng_getRpcModules second.
+func probeModules(ctx context.Context, c *Client) map[string]bool {
+	for _, method := range []string{"rpc_modules", "qng_getRpcModules"} {
+		result, res, err := probe(ctx, c, method, []interface{}{})
+		if err != nil || res != probeOK || len(result) == 0 {
+			continue
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(result, &raw); err != nil {
+			continue
+		}
+		modules := make(map[string]bool, len(raw))
+		for ns, v := range raw {
+			// rpc_modules reports versions, qng_getRpcModules reports flags
+			enabled, isBool := v.(bool)
+			modules[ns] = !isBool || enabled
+		}
+		return modules
+	}
+	return nil
+}
+
+// probeRpcInfo returns the method names the node reports in qng_getRpcInfo.
+func probeRpcInfo(ctx context.Context, c *Client) []string {
+	result, res, err := probe(ctx, c, "qng_getRpcInfo", []interface{}{})
+	if err != nil || res != probeOK {
+		return nil
+	}
+	var status []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(result, &status); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(status))
+	for _, s := range status {
+		if s.Name != "" {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// Discover probes the node behind c and merges the result with catalog.
+// Catalog methods the node does not serve are dropped, methods the node
+// reports that the catalog lacks are added with a generic schema. Methods
+// of namespaces rpc_modules reports disabled are dropped and those
+// qng_getRpcInfo lists are kept without probing them; the node lists only
+// methods it has been asked for, so the others are probed with probeParams.
+func Discover(ctx context.Context, c *Client, catalog QngMethods) (QngMethods, *DiscoveryReport) {
+	probes := c.withPolicy(discoveryProbe)
+	report := &DiscoveryReport{
+		Endpoint:  c.Endpoint(),
+		Time:      time.Now(),
+		Modules:   probeModules(ctx, probes),
+		Available: []string{},
+		Hidden:    []string{},
+		Unknown:   []string{},
+	}
+	listed := probeRpcInfo(ctx, probes)
+	served := make(map[string]struct{}, len(listed))
+	for _, name := range listed {
+		served[name] = struct{}{}
+	}
+
+	merged := make(QngMethods, 0, len(catalog))
+	known := make(map[string]struct{}, len(catalog))
+	calls := make(map[string]struct{}, len(catalog))
+	for _, m := range catalog {
+		known[m.Name] = struct{}{}
+		if ns := namespace(m.Name); report.Modules != nil {
+			if enabled, ok := report.Modules[ns]; ok && !enabled {
+				report.Hidden = append(report.Hidden, m.Name)
+				continue
+			}
+		}
+		res := probeOK
+		var err error
+		if _, ok := served[m.Name]; !ok {
+			_, res, err = probe(ctx, probes, m.Name, probeParams(m))
+		}
+		switch res {
+		case probeMissing:
+			report.Hidden = append(report.Hidden, m.Name)
+			continue
+		case probeFailed:
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", m.Name, err))
+		default:
+			report.Available = append(report.Available, m.Name)
+		}
+		merged = append(merged, m)
+		calls[m.Call] = struct{}{}
+	}
+
+	for _, name := range listed {
+		if _, ok := known[name]; ok {
+			continue
+		}
+		known[name] = struct{}{}
+		m := genericMethod(name, calls)
+		calls[m.Call] = struct{}{}
+		merged = append(merged, m)
+		report.Unknown = append(report.Unknown, name)
+	}
+	sort.Strings(report.Unknown)
+
+	discoveryState.Lock()
+	discoveryState.report = report
+	discoveryState.Unlock()
+
+	log.Info("Node discovery finished", "endpoint", c.Endpoint(),
+		"available", len(report.Available), "hidden", len(report.Hidden),
+		"unknown", len(report.Unknown), "errors", len(report.Errors))
+	if len(report.Hidden) > 0 {
+		log.Info("Hiding methods the node does not serve", "methods", strings.Join(report.Hidden, ","))
+	}
+	if len(report.Unknown) > 0 {
+		log.Info("Exposing uncatalogued node methods", "methods", strings.Join(report.Unknown, ","))
+	}
+	for _, e := range report.Errors {
+		log.Warn("Discovery probe failed", "error", e)
+	}
+	return merged, report
+}
+
+// LastDiscoveryReport returns the report of the most recent discovery, or
+// nil if discovery has not run.
+func LastDiscoveryReport() *DiscoveryReport {
+	discoveryState.RLock()
+	defer discoveryState.RUnlock()
+	return discoveryState.report
+}
+
+// genericMethod builds a catalog entry for a method only the node knows.
+// Its single "params" argument is passed to the node as the positional
+// parameter list.
+func genericMethod(name string, taken map[string]struct{}) Method {
+	call := toSnakeCase(strings.TrimPrefix(name, namespace(name)+"_"))
+	if _, ok := taken[call]; ok || call == "" {
+		call = toSnakeCase(name)
+	}
+	return Method{
+		Name:    name,
+		Call:    call,
+		Desc:    fmt.Sprintf("Calls the %s RPC method of the connected QNG node. This method was discovered on the node and has no documented schema; pass its positional parameters as a JSON array.", name),
+		Generic: true,
+		Params: Params{{
+			Name: "params",
+			Type: ParamArray,
+			Desc: "Positional JSON-RPC parameters, for example [1000, true].",
+		}},
+	}
+}
+
+// namespace returns the RPC namespace of a method name, e.g. qng for
+// qng_getNodeInfo.
+func namespace(name string) string {
+	if i := strings.Index(name, "_"); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// toSnakeCase converts a camelCase RPC name to the snake_case used for
+// tool names, e.g. getBlockByOrder to get_block_by_order.
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 && s[i-1] != '_' {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// minCompactBytes is the file size below which the disk cache is not
+// compacted.
+const minCompactBytes = 1 << 20
+
+// diskCacheOpenTimeout bounds the wait for the file lock of the disk cache,
+// which a running server holds.
+const diskCacheOpenTimeout = time.Second
+
+// DiskCache persists final results of the response cache across restarts.
+// It is a bbolt file, pure Go, with one bucket per network. Entries are
+// evicted least recently used first once MaxBytes is exceeded, and the file
+// is compacted when deleted entries make up more than half of it. It is safe
+// for concurrent use.
+type DiskCache struct {
+	path     string
+	maxBytes int64
+
+	mu sync.Mutex
+	db *bolt.DB
+	// index holds the size and last access of every entry by namespace
+	// and key. touched are the entries read since access times were last
+	// written back, which the next Put, Compact or Close does.
+	index   map[string]map[string]*diskEntry
+	touched map[diskKey]*diskEntry
+	bytes   int64
+	stats   DiskCacheStats
+}
+
+type diskKey struct {
+	namespace, key string
+}
+
+type diskEntry struct {
+	size   int64
+	access int64
+}
+
+// DiskCacheStats is a snapshot of a disk cache, as shown by `cache stats`.
+type DiskCacheStats struct {
+	Path    string `json:"path"`
+	Entries int    `json:"entries"`
+	// Bytes is the size of the cached results, FileBytes that of the file
+	// including space freed by evictions until the next compaction.
+	Bytes     int64          `json:"bytes"`
+	MaxBytes  int64          `json:"max_bytes"`
+	FileBytes int64          `json:"file_bytes"`
+	Networks  map[string]int `json:"networks"`
+	// Hits, Misses, Evictions and Compactions count since the file was
+	// opened.
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Compactions uint64 `json:"compactions"`
+}
+
+// OpenDiskCache opens or creates the disk cache at path. A maxBytes of 0
+// leaves its size unbounded.
+func OpenDiskCache(path string, maxBytes int64) (*DiskCache, error) {
+	d := &DiskCache{path: path, maxBytes: maxBytes}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	if err := d.compactIfNeeded(); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// open opens the file and loads the index. It must be called with mu held
+// or before d is shared.
+func (d *DiskCache) open() error {
+	db, err := bolt.Open(d.path, 0600, &bolt.Options{Timeout: diskCacheOpenTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return fmt.Errorf("cache file %s is locked, is a server using it?", d.path)
+	}
+	if err != nil {
+		return fmt.Errorf("opening cache file %s: %v", d.path, err)
+	}
+	d.db = db
+	d.index = make(map[string]map[string]*diskEntry)
+	d.touched = make(map[diskKey]*diskEntry)
+	d.bytes = 0
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			entries := make(map[string]*diskEntry)
+			d.index[string(name)] = entries
+			return b.ForEach(func(k, v []byte) error {
+				if len(v) < 8 {
+					return nil
+				}
+				e := &diskEntry{size: int64(len(k) + len(v)), access: int64(binary.BigEndian.Uint64(v))}
+				entries[string(k)] = e
+				d.bytes += e.size
+				return nil
+			})
+		})
+	})
+}
+
+// Get returns the result cached under key in namespace.
+func (d *DiskCache) Get(namespace, key string) (json.RawMessage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.index[namespace][key]
+	if !ok {
+		d.stats.Misses++
+		return nil, false
+	}
+	var result json.RawMessage
+	err := d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(namespace)); b != nil {
+			if v := b.Get([]byte(key)); len(v) >= 8 {
+				result = append(json.RawMessage(nil), v[8:]...)
+			}
+		}
+		return nil
+	})
+	if err != nil || result == nil {
+		d.stats.Misses++
+		return nil, false
+	}
+	e.access = time.Now().UnixNano()
+	d.touched[diskKey{namespace, key}] = e
+	d.stats.Hits++
+	return result, true
+}
+
+// Put caches result under key in namespace, evicting the least recently
+// used entries if the cache grows beyond its size cap.
+func (d *DiskCache) Put(namespace, key string, result json.RawMessage) error {
+	now := time.Now().UnixNano()
+	value := make([]byte, 8+len(result))
+	binary.BigEndian.PutUint64(value, uint64(now))
+	copy(value[8:], result)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+		return d.writeAccess(tx)
+	})
+	if err != nil {
+		return err
+	}
+	entries := d.index[namespace]
+	if entries == nil {
+		entries = make(map[string]*diskEntry)
+		d.index[namespace] = entries
+	}
+	if old, ok := entries[key]; ok {
+		d.bytes -= old.size
+	}
+	e := &diskEntry{size: int64(len(key) + len(value)), access: now}
+	entries[key] = e
+	d.bytes += e.size
+	if d.maxBytes > 0 && d.bytes > d.maxBytes {
+		return d.evict()
+	}
+	return nil
+}
+
+// evict removes the least recently used entries until the cache is below
+// 90% of its size cap, then compacts the file if needed. It must be called
+// with mu held.
+func (d *DiskCache) evict() error {
+	type victim struct {
+		namespace, key string
+		*diskEntry
+	}
+	var victims []victim
+	for namespace, entries := range d.index {
+		for key, e := range entries {
+			victims = append(victims, victim{namespace, key, e})
+		}
+	}
+	sort.Slice(victims, func(i, j int) bool { return victims[i].access < victims[j].access })
+	target := d.maxBytes * 9 / 10
+	n := 0
+	for bytes := d.bytes; n < len(victims) && bytes > target; n++ {
+		bytes -= victims[n].size
+	}
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, v := range victims[:n] {
+			if b := tx.Bucket([]byte(v.namespace)); b != nil {
+				if err := b.Delete([]byte(v.key)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range victims[:n] {
+		delete(d.index[v.namespace], v.key)
+		d.bytes -= v.size
+	}
+	d.stats.Evictions += uint64(n)
+	metrics.Add("disk_cache_evictions_total", uint64(n))
+	return d.compactIfNeeded()
+}
+
+// Purge deletes the entries of namespace, or of every namespace if it is
+// empty, and compacts the file.
+func (d *DiskCache) Purge(namespace string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for name := range d.index {
+			if namespace != "" && name != namespace {
+				continue
+			}
+			if err := tx.DeleteBucket([]byte(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for name, entries := range d.index {
+		if namespace != "" && name != namespace {
+			continue
+		}
+		for _, e := range entries {
+			d.bytes -= e.size
+		}
+		delete(d.index, name)
+	}
+	return d.compact()
+}
+
+// Compact rewrites the file without the space freed by deleted entries.
+func (d *DiskCache) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.compact()
+}
+
+// compactIfNeeded compacts the file once deleted entries make up more
+// than half of it. It must be called with mu held.
+func (d *DiskCache) compactIfNeeded() error {
+	size, err := d.fileSize()
+	if err != nil || size < minCompactBytes || size < 2*d.bytes {
+		return err
+	}
+	return d.compact()
+}
+
+// compact copies the live entries into a new file that replaces the old
+// one. It must be called with mu held.
+func (d *DiskCache) compact() error {
+	if err := d.flushAccess(); err != nil {
+		return err
+	}
+	before, _ := d.fileSize()
+	tmp := d.path + ".compact"
+	os.Remove(tmp)
+	dst, err := bolt.Open(tmp, 0600, &bolt.Options{Timeout: diskCacheOpenTimeout})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, d.db, 1<<20); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("compacting cache file: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := d.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return err
+	}
+	if err := d.open(); err != nil {
+		return err
+	}
+	after, _ := d.fileSize()
+	d.stats.Compactions++
+	metrics.Inc("disk_cache_compactions_total")
+	log.Debug("Compacted cache file", "path", d.path, "before", before, "after", after)
+	return nil
+}
+
+// flushAccess writes the access times changed by Get back to the file. It
+// must be called with mu held.
+func (d *DiskCache) flushAccess() error {
+	if len(d.touched) == 0 {
+		return nil
+	}
+	return d.db.Update(d.writeAccess)
+}
+
+// writeAccess writes the access times of the touched entries in tx. It must
+// be called with mu held.
+func (d *DiskCache) writeAccess(tx *bolt.Tx) error {
+	for k, e := range d.touched {
+		b := tx.Bucket([]byte(k.namespace))
+		if b == nil {
+			continue
+		}
+		v := b.Get([]byte(k.key))
+		if len(v) < 8 {
+			continue
+		}
+		value := append([]byte(nil), v...)
+		binary.BigEndian.PutUint64(value, uint64(e.access))
+		if err := b.Put([]byte(k.key), value); err != nil {
+			return err
+		}
+	}
+	// access times only order evictions; if tx fails they are lost and
+	// the entries merely look older
+	d.touched = make(map[diskKey]*diskEntry)
+	return nil
+}
+
+func (d *DiskCache) fileSize() (int64, error) {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Stats returns a snapshot of the cache.
+func (d *DiskCache) Stats() DiskCacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.Path = d.path
+	stats.Bytes = d.bytes
+	stats.MaxBytes = d.maxBytes
+	stats.FileBytes, _ = d.fileSize()
+	stats.Networks = make(map[string]int, len(d.index))
+	for namespace, entries := range d.index {
+		if len(entries) > 0 {
+			stats.Entries += len(entries)
+			stats.Networks[namespace] = len(entries)
+		}
+	}
+	return stats
+}
+
+// Close writes back access times and closes the file.
+func (d *DiskCache) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.db == nil {
+		return nil
+	}
+	err := d.flushAccess()
+	if cerr := d.db.Close(); err == nil {
+		err = cerr
+	}
+	d.db = nil
+	return err
+}
+
+// runCacheCommand runs `qng-mcp cache stats|purge` against the cache file
+// of a stopped server and returns the exit code.
+func runCacheCommand(args []string) int {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	path := fs.String("cache-file", "", "Disk cache file of the server")
+	network := fs.String("network", "", "Purge only the results of this network")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: qng-mcp cache stats|purge -cache-file path [-network name]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *path == "" || (command != "stats" && command != "purge") {
+		fs.Usage()
+		return 2
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	d, err := OpenDiskCache(*path, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	defer d.Close()
+	if command == "purge" {
+		if err := d.Purge(*network); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+	}
+	data, err := json.MarshalIndent(d.Stats(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
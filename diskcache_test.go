@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qng-mcp-server/fakenode"
+)
+
+func TestDiskCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	d, err := OpenDiskCache(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Put("mainnet", "a", json.RawMessage(`{"order":1}`))
+	d.Put("testnet", "a", json.RawMessage(`{"order":2}`))
+	if _, err := OpenDiskCache(path, 0); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("Expected a second open to find the file locked, got %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// results survive a reopen, per network
+	d, err = OpenDiskCache(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, ok := d.Get("testnet", "a"); !ok || string(result) != `{"order":2}` {
+		t.Errorf("Expected the testnet result, got %s, %v", result, ok)
+	}
+	if _, ok := d.Get("privnet", "a"); ok {
+		t.Error("Expected networks not to share results")
+	}
+	stats := d.Stats()
+	if stats.Entries != 2 || stats.Networks["mainnet"] != 1 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := d.Purge("mainnet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Get("mainnet", "a"); ok {
+		t.Error("Expected the purged network to be empty")
+	}
+	if _, ok := d.Get("testnet", "a"); !ok {
+		t.Error("Expected other networks to survive a purge")
+	}
+	d.Purge("")
+	if stats := d.Stats(); stats.Entries != 0 || stats.Bytes != 0 || stats.Compactions != 2 {
+		t.Errorf("Expected an empty, compacted cache, got %+v", stats)
+	}
+	d.Close()
+
+	if code := runCacheCommand([]string{"purge", "-cache-file", path, "-network", "mainnet"}); code != 0 {
+		t.Errorf("Expected cache purge to succeed, got exit code %d", code)
+	}
+	if code := runCacheCommand([]string{"compact", "-cache-file", path}); code != 2 {
+		t.Errorf("Expected an unknown cache command to be a usage error, got exit code %d", code)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	value := json.RawMessage(`"` + strings.Repeat("x", 1000) + `"`)
+	d, err := OpenDiskCache(path, 100_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for i := 0; i < 80; i++ {
+		d.Put("mainnet", fmt.Sprint(i), value)
+	}
+	// reading the oldest entry keeps it
+	if _, ok := d.Get("mainnet", "0"); !ok {
+		t.Fatal("Expected entry 0 to be cached")
+	}
+	time.Sleep(time.Millisecond)
+	for i := 80; i < 120; i++ {
+		d.Put("mainnet", fmt.Sprint(i), value)
+	}
+	stats := d.Stats()
+	if stats.Bytes > 100_000 || stats.Evictions == 0 {
+		t.Errorf("Expected the size cap to hold, got %+v", stats)
+	}
+	if _, ok := d.Get("mainnet", "0"); !ok {
+		t.Error("Expected the recently read entry to survive eviction")
+	}
+	if _, ok := d.Get("mainnet", "1"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+
+	// evicting most of a large file compacts it
+	d.maxBytes = 0
+	for i := 0; i < 1500; i++ {
+		d.Put("testnet", fmt.Sprint(i), value)
+	}
+	before := d.Stats()
+	d.maxBytes = 100_000
+	d.Put("testnet", "last", value)
+	after := d.Stats()
+	if after.Compactions <= before.Compactions || after.FileBytes >= before.FileBytes {
+		t.Errorf("Expected the file to be compacted, got %+v after %+v", after, before)
+	}
+}
+
+func TestResponseCacheDisk(t *testing.T) {
+	srv, calls := newChainNode(t)
+	path := filepath.Join(t.TempDir(), "cache.db")
+	ctx := context.Background()
+	open := func() *Client {
+		t.Helper()
+		disk, err := OpenDiskCache(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewFailoverClient([]EndpointConfig{{URL: srv.URL, Network: "testnet"}},
+			WithCache(CacheConfig{Size: 10, FinalDepth: 10, TipTTL: time.Minute, Disk: disk}))
+	}
+
+	c := open()
+	c.GetBlockByOrder(ctx, 10)
+	c.GetBlockByOrder(ctx, 95)
+	if stats := c.CacheStats(); stats.Disk == nil || stats.Disk.Networks["testnet"] != 1 {
+		t.Errorf("Expected only the final block on disk, got %+v", stats.Disk)
+	}
+	c.cache.config.Disk.Close()
+
+	// a restarted server answers from disk
+	c = open()
+	defer c.cache.config.Disk.Close()
+	if block, err := c.GetBlockByOrder(ctx, 10); err != nil || block.Order != 10 {
+		t.Fatalf("Expected block 10, got %+v, %v", block, err)
+	}
+	if n := calls("qng_getBlockByOrder"); n != 2 {
+		t.Errorf("Expected the final block to come from disk, got %d requests", n)
+	}
+	if stats := c.CacheStats(); stats.Hits != 1 || stats.Disk.Hits != 1 {
+		t.Errorf("Expected a disk hit, got %+v", stats)
+	}
+}
+
+// TestResponseCacheDiskNodeNetwork checks that clients without a configured
+// network keep the results of each chain apart in the disk cache.
+func TestResponseCacheDiskNodeNetwork(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	ctx := context.Background()
+	blockOn := func(network string) (*fakenode.Server, string) {
+		t.Helper()
+		srv, err := fakenode.NewServer(fakenode.Config{Network: network})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		disk, err := OpenDiskCache(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer disk.Close()
+		c := NewClient(srv.URL, WithCache(CacheConfig{Size: 10, FinalDepth: 10, TipTTL: time.Minute, Disk: disk}))
+		waitNamespace(t, c, network)
+		block, err := c.GetBlockByOrder(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return srv, block.Hash
+	}
+
+	testnet, hash := blockOn("testnet")
+	if testnet.Node.Calls("qng_getBlockByOrder") != 1 {
+		t.Fatal("Expected the first block to come from the node")
+	}
+	mainnet, _ := blockOn("mainnet")
+	if mainnet.Node.Calls("qng_getBlockByOrder") != 1 {
+		t.Errorf("Expected a node of another chain not to be answered from the cache")
+	}
+	again, againHash := blockOn("testnet")
+	if again.Node.Calls("qng_getBlockByOrder") != 0 || againHash != hash {
+		t.Errorf("Expected a node of the same chain to be answered from the cache, got %s", againHash)
+	}
+}
+
+// waitNamespace waits until the cache of c knows the network of its node.
+func waitNamespace(t *testing.T, c *Client, network string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if c.cache.diskNamespace() == network {
+			return
+		}
+	}
+	t.Fatalf("Expected the disk cache namespace %s, got %q", network, c.cache.diskNamespace())
+}
+
+// TestResponseCacheDiskNamespaceBackoff checks that the node's network is
+// looked up in the background, and not again right after a failure.
+func TestResponseCacheDiskNamespaceBackoff(t *testing.T) {
+	var lookups atomic.Int32
+	var up atomic.Bool
+	node := newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		if method != "qng_getNodeInfo" {
+			return nil, &RPCError{Code: -32601, Message: "Method not found"}
+		}
+		lookups.Add(1)
+		if !up.Load() {
+			return nil, &RPCError{Code: -1, Message: "starting"}
+		}
+		return map[string]interface{}{"network": "testnet"}, nil
+	})
+	disk, err := OpenDiskCache(filepath.Join(t.TempDir(), "cache.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	defer func(old RetryPolicy) { namespaceRetry = old }(namespaceRetry)
+	namespaceRetry.Backoff = Backoff{Initial: Duration(100 * time.Millisecond), Max: Duration(100 * time.Millisecond), Multiplier: 1}
+
+	c := NewClient(node.URL, WithCache(CacheConfig{Size: 10, FinalDepth: 10, TipTTL: time.Minute, Disk: disk}))
+	for deadline := time.Now().Add(5 * time.Second); lookups.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		if namespace := c.cache.diskNamespace(); namespace != "" {
+			t.Fatalf("Expected no namespace while the lookup fails, got %s", namespace)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("Expected one lookup within the backoff, got %d", n)
+	}
+	up.Store(true)
+	waitNamespace(t, c, "testnet")
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// healthCheckTimeout bounds each health probe.
+const healthCheckTimeout = 10 * time.Second
+
+// EndpointConfig describes a node endpoint.
+type EndpointConfig struct {
+	// Name identifies the endpoint in logs and status; it defaults to the
+	// host of URL.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	URL  string `json:"url" yaml:"url"`
+	// Priority orders the endpoints; lower values are preferred.
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Auth and TLS hold the credentials the endpoint is reached with.
+	Auth *AuthConfig `json:"auth,omitempty" yaml:"auth,omitempty"`
+	TLS  *TLSConfig  `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// Network is the QNG network the node must report in qng_getNodeInfo,
+	// such as mainnet or testnet. Endpoints of a network profile get it
+	// from the profile.
+	Network string `json:"network,omitempty" yaml:"network,omitempty"`
+	// RateLimit overrides the rate limit set with the -rate-limit flags.
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+}
+
+// ParseEndpointList parses a comma separated list of URLs, as given with
+// -rpc. Endpoints are preferred in the order they are listed.
+func ParseEndpointList(list string) ([]EndpointConfig, error) {
+	var endpoints []EndpointConfig
+	for _, u := range strings.Split(list, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			endpoints = append(endpoints, EndpointConfig{URL: u, Priority: len(endpoints)})
+		}
+	}
+	if err := validateEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// ParseEndpoints parses an endpoints file. ext selects YAML for ".yaml" and
+// ".yml" and JSON otherwise.
+func ParseEndpoints(data []byte, ext string) ([]EndpointConfig, error) {
+	return parseEndpoints(data, ext, "")
+}
+
+// parseEndpoints parses an endpoints file, resolving the relative paths of
+// credential files against dir.
+func parseEndpoints(data []byte, ext, dir string) ([]EndpointConfig, error) {
+	var config struct {
+		Endpoints []EndpointConfig `json:"endpoints" yaml:"endpoints"`
+	}
+	var err error
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	default:
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing endpoints: %v", err)
+	}
+	for _, e := range config.Endpoints {
+		if e.Auth != nil {
+			e.Auth.resolve(dir)
+		}
+		if e.TLS != nil {
+			e.TLS.resolve(dir)
+		}
+	}
+	if err := validateEndpoints(config.Endpoints); err != nil {
+		return nil, err
+	}
+	return config.Endpoints, nil
+}
+
+// LoadEndpointsFile reads and validates the endpoints file stored at path.
+// Relative paths of credential files are taken from the file's directory.
+func LoadEndpointsFile(path string) ([]EndpointConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEndpoints(data, filepath.Ext(path), filepath.Dir(path))
+}
+
+// validateEndpoints checks the URLs and fills in default names.
+func validateEndpoints(endpoints []EndpointConfig) error {
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no endpoints configured")
+	}
+	urls := make(map[string]struct{}, len(endpoints))
+	names := make(map[string]struct{}, len(endpoints))
+	for i := range endpoints {
+		e := &endpoints[i]
+		u, err := url.Parse(e.URL)
+		switch {
+		case err != nil:
+		case u.Scheme == "ipc":
+			if ipcPath(e.URL) == "" {
+				return fmt.Errorf("endpoint %d: invalid URL %q, expected ipc:///path/to/socket", i, redactURL(e.URL))
+			}
+		case u.Host == "":
+			err = fmt.Errorf("missing host")
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ws" && u.Scheme != "wss":
+			err = fmt.Errorf("unsupported scheme")
+		}
+		if err != nil {
+			return fmt.Errorf("endpoint %d: invalid URL %q, expected http(s)://, ws(s):// or ipc://", i, redactURL(e.URL))
+		}
+		if _, ok := urls[e.URL]; ok {
+			return fmt.Errorf("endpoint %d: duplicate URL %q", i, redactURL(e.URL))
+		}
+		urls[e.URL] = struct{}{}
+		if e.Name == "" {
+			e.Name = endpointName(u)
+			if _, ok := names[e.Name]; ok {
+				e.Name = fmt.Sprintf("%s#%d", e.Name, i)
+			}
+		}
+		if _, ok := names[e.Name]; ok {
+			return fmt.Errorf("endpoint %d: duplicate name %q", i, e.Name)
+		}
+		names[e.Name] = struct{}{}
+		if e.RateLimit != nil {
+			if err := e.RateLimit.validate(); err != nil {
+				return fmt.Errorf("endpoint %s: %v", e.Name, err)
+			}
+		}
+		if _, _, ok := chainParams(e.Network); e.Network != "" && !ok {
+			return fmt.Errorf("endpoint %s: unknown network %q, expected one of %s", e.Name, e.Network, strings.Join(networkNames(), ", "))
+		}
+		if _, _, err := e.credentials(); err != nil {
+			return fmt.Errorf("endpoint %s: %v", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// credentials loads the Authorization header function and TLS settings of
+// e; either is nil when not configured.
+func (e *EndpointConfig) credentials() (func() (string, error), *tls.Config, error) {
+	var (
+		authorize func() (string, error)
+		tlsConfig *tls.Config
+		err       error
+	)
+	if e.Auth != nil {
+		if authorize, err = e.Auth.authorizer(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if e.TLS != nil {
+		if tlsConfig, err = e.TLS.clientConfig(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return authorize, tlsConfig, nil
+}
+
+// redactURL removes the password of a URL so it can be shown and logged.
+func redactURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Redacted()
+}
+
+// endpointName is the default name of the endpoint at u: its host, or the
+// socket path of an IPC endpoint.
+func endpointName(u *url.URL) string {
+	if u.Scheme == "ipc" {
+		return u.Path
+	}
+	return u.Host
+}
+
+// authKinds describes the credentials of config for EndpointStatus.
+func authKinds(config EndpointConfig) string {
+	var kinds []string
+	if m := config.Auth.Method(); m != "" {
+		kinds = append(kinds, m)
+	}
+	if config.TLS != nil && config.TLS.CertFile != "" {
+		kinds = append(kinds, "mtls")
+	}
+	return strings.Join(kinds, ",")
+}
+
+// EndpointStatus is a snapshot of the state of an endpoint.
+type EndpointStatus struct {
+	Name string `json:"name"`
+	// URL is shown without its password.
+	URL      string `json:"url"`
+	Priority int    `json:"priority"`
+	// Network is the network the endpoint must serve.
+	Network string `json:"network,omitempty"`
+	// Auth lists the kinds of credentials used, such as "basic" or
+	// "jwt,mtls".
+	Auth string `json:"auth,omitempty"`
+	// Healthy endpoints receive requests. Until the first health check
+	// every endpoint counts as healthy.
+	Healthy bool `json:"healthy"`
+	// Reason explains why an endpoint is not healthy.
+	Reason string `json:"reason,omitempty"`
+	// Current is the node's answer to qng_isCurrent.
+	Current    *bool     `json:"current,omitempty"`
+	BlockCount uint64    `json:"block_count,omitempty"`
+	Lag        uint64    `json:"lag,omitempty"`
+	LastCheck  time.Time `json:"last_check,omitempty"`
+	// Requests and Failures count the requests sent to the endpoint.
+	Requests  uint64    `json:"requests"`
+	Failures  uint64    `json:"failures"`
+	LastUsed  time.Time `json:"last_used,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	// Breaker is the state of the endpoint's circuit breaker and Rejected
+	// counts the requests it or the concurrency limiter turned away.
+	Breaker  string `json:"breaker"`
+	Rejected uint64 `json:"rejected"`
+	// ConcurrencyLimit is the current adaptive limit of requests in flight,
+	// 0 if unlimited.
+	ConcurrencyLimit int `json:"concurrency_limit"`
+	InFlight         int `json:"in_flight"`
+	Queued           int `json:"queued"`
+}
+
+// Endpoint is a node endpoint of a Client.
+type Endpoint struct {
+	EndpointConfig
+
+	breaker *breaker
+	limiter *limiter
+	// rate holds the token buckets of the endpoint's rate limit.
+	rate *rateLimiter
+	// ws carries the requests of ws:// and wss:// endpoints.
+	ws *wsConn
+	// ipc is the socket path of ipc:// endpoints.
+	ipc string
+	// authorize returns the Authorization header of a request, and
+	// httpClient carries the endpoint's TLS settings; both are nil unless
+	// the endpoint has credentials of its own.
+	authorize  func() (string, error)
+	httpClient *http.Client
+	// credentialsErr is set when the credentials could not be loaded.
+	credentialsErr error
+	// networkVerified is set once the node reported the expected network.
+	networkVerified atomic.Bool
+
+	mu     sync.Mutex
+	status EndpointStatus
+	// retryAt is set when a failed request took the endpoint out of
+	// rotation. From then on it is tried again, and the first request it
+	// answers brings it back, so it recovers without health checks.
+	retryAt time.Time
+}
+
+func newEndpoint(config EndpointConfig, breakerConfig BreakerConfig, concurrency ConcurrencyConfig, rateLimit RateLimitConfig) *Endpoint {
+	if config.Name == "" {
+		config.Name = config.URL
+		if u, err := url.Parse(config.URL); err == nil && endpointName(u) != "" {
+			config.Name = endpointName(u)
+		}
+	}
+	return &Endpoint{
+		EndpointConfig: config,
+		breaker:        newBreaker(config.Name, breakerConfig),
+		limiter:        newLimiter(config.Name, concurrency),
+		rate:           newRateLimiter(config.Name, rateLimit),
+		status: EndpointStatus{
+			Name:     config.Name,
+			URL:      redactURL(config.URL),
+			Priority: config.Priority,
+			Network:  config.Network,
+			Auth:     authKinds(config),
+			Healthy:  true,
+		},
+	}
+}
+
+// Status returns a snapshot of the endpoint's state.
+func (e *Endpoint) Status() EndpointStatus {
+	e.mu.Lock()
+	status := e.status
+	e.mu.Unlock()
+	status.Breaker = e.breaker.State()
+	status.ConcurrencyLimit, status.InFlight, status.Queued = e.limiter.stats()
+	return status
+}
+
+func (e *Endpoint) healthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status.Healthy || (!e.retryAt.IsZero() && !time.Now().Before(e.retryAt))
+}
+
+// setHealth records a health verdict and logs transitions.
+func (e *Endpoint) setHealth(healthy bool, reason string) {
+	e.mu.Lock()
+	was := e.status.Healthy
+	e.status.Healthy = healthy
+	e.status.Reason = reason
+	e.retryAt = time.Time{}
+	e.mu.Unlock()
+	switch {
+	case was && !healthy:
+		log.Warn("Endpoint unhealthy", "endpoint", e.Name, "reason", reason)
+	case !was && healthy:
+		log.Info("Endpoint healthy again", "endpoint", e.Name)
+	}
+}
+
+// demote takes e out of rotation after a failed request, until cooldown has
+// passed or a health check finds it healthy.
+func (e *Endpoint) demote(reason string, cooldown time.Duration) {
+	e.setHealth(false, reason)
+	e.mu.Lock()
+	e.retryAt = time.Now().Add(cooldown)
+	e.mu.Unlock()
+}
+
+// answered brings e back into rotation if a failed request took it out.
+// Verdicts of the health checker, such as a lagging node, stand.
+func (e *Endpoint) answered() {
+	e.mu.Lock()
+	demoted := !e.retryAt.IsZero()
+	e.mu.Unlock()
+	if demoted {
+		e.setHealth(true, "")
+	}
+}
+
+// recordRequest counts a request and its outcome.
+func (e *Endpoint) recordRequest(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.Requests++
+	e.status.LastUsed = time.Now()
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+	}
+}
+
+// recordRejected counts a request turned away without contacting the
+// endpoint.
+func (e *Endpoint) recordRejected(err *backoffError) {
+	e.mu.Lock()
+	e.status.Rejected++
+	e.mu.Unlock()
+	metrics.Inc("rpc_rejected_total", "endpoint", e.Name, "reason", err.Reason)
+}
+
+// sortEndpoints orders endpoints by priority, keeping the configured order
+// among equal priorities.
+func sortEndpoints(endpoints []*Endpoint) {
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+}
+
+// candidates returns the endpoints to try in order: the healthy ones by
+// priority, or all of them if none is healthy.
+func (c *Client) candidates() []*Endpoint {
+	healthy := make([]*Endpoint, 0, len(c.endpoints))
+	for _, e := range c.endpoints {
+		if e.healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		return c.endpoints
+	}
+	return healthy
+}
+
+// Endpoints returns the state of every endpoint in priority order.
+func (c *Client) Endpoints() []EndpointStatus {
+	status := make([]EndpointStatus, len(c.endpoints))
+	for i, e := range c.endpoints {
+		status[i] = e.Status()
+	}
+	return status
+}
+
+// HasEndpoint reports whether url is one of the client's endpoints.
+func (c *Client) HasEndpoint(url string) bool {
+	for _, e := range c.endpoints {
+		if e.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHealth probes every endpoint with qng_isCurrent and
+// qng_getBlockCount. An endpoint is taken out of rotation while it cannot be
+// reached, is not current, or is more than maxLag blocks behind the best
+// endpoint. Endpoints of a network are also kept out until their node
+// reports that network.
+func (c *Client) CheckHealth(ctx context.Context, maxLag uint64) {
+	type probe struct {
+		current bool
+		count   uint64
+		err     error
+	}
+	probes := make([]probe, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range c.endpoints {
+		wg.Add(1)
+		go func(i int, e *Endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			p := &probes[i]
+			if p.err = c.checkNetwork(ctx, e); p.err != nil {
+				return
+			}
+			if p.err = c.callEndpoint(ctx, e, "qng_isCurrent", &p.current); p.err == nil {
+				p.err = c.callEndpoint(ctx, e, "qng_getBlockCount", &p.count)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	var best uint64
+	for _, p := range probes {
+		if p.err == nil && p.count > best {
+			best = p.count
+		}
+	}
+	now := time.Now()
+	for i, e := range c.endpoints {
+		p := probes[i]
+		e.mu.Lock()
+		e.status.LastCheck = now
+		if p.err == nil {
+			current := p.current
+			e.status.Current = &current
+			e.status.BlockCount = p.count
+			e.status.Lag = best - p.count
+		}
+		e.mu.Unlock()
+
+		var mismatch *networkMismatchError
+		switch {
+		case errors.As(p.err, &mismatch):
+			e.setHealth(false, mismatch.Error())
+		case p.err != nil:
+			e.setHealth(false, fmt.Sprintf("unreachable: %v", p.err))
+		case !p.current:
+			e.setHealth(false, "not synced: qng_isCurrent is false")
+		case best-p.count > maxLag:
+			e.setHealth(false, fmt.Sprintf("lagging %d blocks behind", best-p.count))
+		default:
+			e.setHealth(true, "")
+		}
+	}
+}
+
+// RunHealthChecks checks the endpoints every interval until ctx ends.
+func (c *Client) RunHealthChecks(ctx context.Context, interval time.Duration, maxLag uint64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.CheckHealth(ctx, maxLag)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleEndpointStatus handles the qng_endpoint_status tool request.
+func (s *MCPServer) handleEndpointStatus(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	return jsonToolResult(s.rpc.Endpoints())
+}
+
+// handleEndpointsResource serves the qng://endpoints resource.
+func (s *MCPServer) handleEndpointsResource(
+	ctx context.Context,
+	request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(s.rpc.Endpoints(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}, nil
+}
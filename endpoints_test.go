@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	list, err := ParseEndpointList("http://a:8545/, https://b:8545/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "a:8545" || list[1].Priority != 1 {
+		t.Errorf("Unexpected endpoints: %+v", list)
+	}
+
+	yamlFile := `endpoints:
+  - name: backup
+    url: https://backup.example:8545/
+    priority: 10
+  - name: local
+    url: http://127.0.0.1:8545/
+`
+	endpoints, err := ParseEndpoints([]byte(yamlFile), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewFailoverClient(endpoints)
+	if status := c.Endpoints(); status[0].Name != "local" || status[1].Name != "backup" {
+		t.Errorf("Expected endpoints ordered by priority, got %+v", status)
+	}
+
+	for _, bad := range []string{"", "127.0.0.1:8545", "ftp://a/", "http://a/,http://a/"} {
+		if _, err := ParseEndpointList(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+// newHealthNode starts a node that answers qng_isCurrent and
+// qng_getBlockCount, and anything else with its name.
+func newHealthNode(t *testing.T, name string, current bool, count uint64) *httptest.Server {
+	return newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		switch method {
+		case "qng_isCurrent":
+			return current, nil
+		case "qng_getBlockCount":
+			return count, nil
+		}
+		return name, nil
+	})
+}
+
+func TestFailover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer hanging.Close()
+	backup := newHealthNode(t, "backup", true, 100)
+
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: 50 * time.Millisecond, MaxAttempts: 1}
+	}
+	c := NewFailoverClient([]EndpointConfig{
+		{Name: "down", URL: down.URL},
+		{Name: "hanging", URL: hanging.URL, Priority: 1},
+		{Name: "backup", URL: backup.URL, Priority: 2},
+	}, WithRetryPolicy(once))
+
+	var name string
+	if err := c.Call(context.Background(), "qng_getNodeInfo", nil, &name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "backup" {
+		t.Errorf("Expected the backup endpoint to answer, got %q", name)
+	}
+	status := c.Endpoints()
+	if status[0].Healthy || status[1].Healthy || !status[2].Healthy {
+		t.Errorf("Expected the failed endpoints to be taken out of rotation, got %+v", status)
+	}
+	if status[2].Requests != 1 || status[0].Failures != 1 || status[1].Failures != 1 {
+		t.Errorf("Unexpected request counts: %+v", status)
+	}
+	if c.Endpoint() != backup.URL {
+		t.Errorf("Expected requests to go to the backup first, got %s", c.Endpoint())
+	}
+}
+
+// TestFailoverRecovery checks that an endpoint taken out of rotation by a
+// failed request comes back without health checks, as with
+// --health-interval=0.
+func TestFailoverRecovery(t *testing.T) {
+	var slow atomic.Bool
+	slow.Store(true)
+	primary := newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		if slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return "primary", nil
+	})
+	backup := newHealthNode(t, "backup", true, 100)
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: 50 * time.Millisecond, MaxAttempts: 1}
+	}
+	c := NewFailoverClient([]EndpointConfig{
+		{Name: "primary", URL: primary.URL},
+		{Name: "backup", URL: backup.URL, Priority: 1},
+	}, WithRetryPolicy(once), WithBreaker(BreakerConfig{Failures: 5, Cooldown: 100 * time.Millisecond, Probes: 1}))
+
+	call := func() string {
+		t.Helper()
+		var name string
+		if err := c.Call(context.Background(), "qng_getNodeInfo", nil, &name); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	if name := call(); name != "backup" || c.Endpoints()[0].Healthy {
+		t.Fatalf("Expected the slow primary to be taken out of rotation, got %q and %+v", name, c.Endpoints()[0])
+	}
+	slow.Store(false)
+	if name := call(); name != "backup" {
+		t.Errorf("Expected the backup to answer during the cooldown, got %q", name)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if name := call(); name != "primary" {
+		t.Errorf("Expected the primary to be tried again after the cooldown, got %q", name)
+	}
+	if status := c.Endpoints()[0]; !status.Healthy || status.Reason != "" {
+		t.Errorf("Expected the primary to be healthy again, got %+v", status)
+	}
+
+	// a verdict of the health checker is not undone by a request
+	c.endpoints[0].setHealth(false, "lagging 50 blocks behind")
+	c.endpoints[0].answered()
+	if c.Endpoints()[0].Healthy {
+		t.Error("Expected a health check verdict to stand")
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	best := newHealthNode(t, "best", true, 100)
+	unsynced := newHealthNode(t, "unsynced", false, 100)
+	lagging := newHealthNode(t, "lagging", true, 80)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c := NewFailoverClient([]EndpointConfig{
+		{Name: "unsynced", URL: unsynced.URL},
+		{Name: "lagging", URL: lagging.URL, Priority: 1},
+		{Name: "down", URL: down.URL, Priority: 2},
+		{Name: "best", URL: best.URL, Priority: 3},
+	})
+	c.CheckHealth(context.Background(), 10)
+
+	healthy := map[string]bool{}
+	for _, s := range c.Endpoints() {
+		healthy[s.Name] = s.Healthy
+		if s.Name == "lagging" && (s.Lag != 20 || s.BlockCount != 80) {
+			t.Errorf("Expected a lag of 20 blocks, got %+v", s)
+		}
+	}
+	if !healthy["best"] || healthy["unsynced"] || healthy["lagging"] || healthy["down"] {
+		t.Errorf("Unexpected health: %v", healthy)
+	}
+	var name string
+	if err := c.Call(context.Background(), "qng_getNodeInfo", nil, &name); err != nil || name != "best" {
+		t.Errorf("Expected the healthy endpoint to answer, got %q, %v", name, err)
+	}
+
+	// a lag within the limit keeps the endpoint
+	c.CheckHealth(context.Background(), 20)
+	if s := c.Endpoints()[1]; s.Name != "lagging" || !s.Healthy {
+		t.Errorf("Expected the lagging endpoint to be healthy with a larger limit, got %+v", s)
+	}
+}
+
+func TestEndpointStatusTool(t *testing.T) {
+	node := newHealthNode(t, "node", true, 7)
+	rpc := NewFailoverClient([]EndpointConfig{{Name: "main", URL: node.URL}})
+	rpc.CheckHealth(context.Background(), 10)
+	c := newTestClient(t, NewMCPServer(rpc))
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "qng_endpoint_status"
+	result, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status []EndpointStatus
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 || status[0].Name != "main" || status[0].BlockCount != 7 || !status[0].Healthy {
+		t.Errorf("Unexpected endpoint status: %+v", status)
+	}
+
+	read := mcp.ReadResourceRequest{}
+	read.Params.URI = "qng://endpoints"
+	resource, err := c.ReadResource(context.Background(), read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, ok := resource.Contents[0].(mcp.TextResourceContents)
+	if !ok || json.Unmarshal([]byte(text.Text), &status) != nil || status[0].URL != node.URL {
+		t.Errorf("Unexpected endpoints resource: %+v", resource.Contents)
+	}
+}
+
+// TestEndpointRedacted checks that the password of an endpoint URL does not
+// reach the log.
+func TestEndpointRedacted(t *testing.T) {
+	node := newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		return map[string]interface{}{"stateroot": "00"}, nil
+	})
+	var buf bytes.Buffer
+	handler := log.Root().GetHandler()
+	log.Root().SetHandler(log.StreamHandler(&buf, log.LogfmtFormat()))
+	defer log.Root().SetHandler(handler)
+
+	endpoint := strings.Replace(node.URL, "http://", "http://qng:s3cret@", 1)
+	rpc := NewClient(endpoint)
+	if strings.Contains(rpc.Endpoint(), "s3cret") {
+		t.Errorf("Expected the password to be redacted, got %s", rpc.Endpoint())
+	}
+	c := newTestClient(t, NewMCPServer(rpc))
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "qng_get_stateroot"
+	req.Params.Arguments = map[string]interface{}{"block_order": float64(1), "rpc_url": endpoint}
+	if _, err := c.CallTool(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	Discover(context.Background(), rpc, nil)
+
+	if !strings.Contains(buf.String(), "qng:xxxxx@") {
+		t.Errorf("Expected the endpoint to be logged, got %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "s3cret") {
+		t.Errorf("Expected no password in the log, got %s", buf.String())
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxRecentEvents is the number of node events kept per topic.
+const maxRecentEvents = 50
+
+// methodResourceUpdated tells clients that a resource changed.
+const methodResourceUpdated = "notifications/resources/updated"
+
+// eventLog keeps the most recent node events of each topic.
+type eventLog struct {
+	mu     sync.Mutex
+	events map[string][]Notification
+}
+
+func (l *eventLog) add(n Notification) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.events == nil {
+		l.events = make(map[string][]Notification)
+	}
+	events := append(l.events[n.Topic], n)
+	if len(events) > maxRecentEvents {
+		events = events[len(events)-maxRecentEvents:]
+	}
+	l.events[n.Topic] = events
+}
+
+func (l *eventLog) recent(topic string) []Notification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Notification{}, l.events[topic]...)
+}
+
+// eventsURI is the resource that lists the recent events of topic.
+func eventsURI(topic string) string {
+	return "qng://events/" + topic
+}
+
+// ParseTopics parses a comma separated list of subscription topics.
+func ParseTopics(list string) ([]string, error) {
+	var topics []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if _, ok := SubscriptionTopics[t]; !ok {
+			return nil, fmt.Errorf("unknown subscription topic %q, expected blocks or mempool", t)
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+// SubscribeNode subscribes to the node events of topics. Each topic gets a
+// qng://events/<topic> resource with its recent events, and connected
+// clients are sent notifications/resources/updated whenever one arrives.
+func (s *MCPServer) SubscribeNode(ctx context.Context, topics []string) error {
+	for _, topic := range topics {
+		uri := eventsURI(topic)
+		err := s.rpc.Subscribe(ctx, topic, func(n Notification) {
+			s.events.add(n)
+			s.server.SendNotificationToAllClients(methodResourceUpdated, map[string]any{"uri": uri})
+		})
+		if err != nil {
+			return err
+		}
+		s.server.AddResource(mcp.NewResource(uri, "QNG "+topic+" events",
+			mcp.WithResourceDescription(fmt.Sprintf("The %d most recent %s events pushed by the QNG node, oldest first. Clients are notified with %s when a new one arrives.", maxRecentEvents, topic, methodResourceUpdated)),
+			mcp.WithMIMEType("application/json"),
+		), s.handleEventsResource(topic))
+	}
+	return nil
+}
+
+// handleEventsResource serves the qng://events/<topic> resource.
+func (s *MCPServer) handleEventsResource(topic string) func(context.Context, mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		data, err := json.MarshalIndent(s.events.recent(topic), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{mcp.TextResourceContents{
+			URI:      request.Params.URI,
+			MIMEType: "application/json",
+			Text:     string(data),
+		}}, nil
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Qitmeer/qng/log"
+
+	"qng-mcp-server/fakenode"
+)
+
+// runFakenodeCommand implements qng-mcp fakenode, which serves a simulated
+// QNG node until interrupted. It returns the exit code.
+func runFakenodeCommand(args []string) int {
+	fs := flag.NewFlagSet("fakenode", flag.ContinueOnError)
+	var config fakenode.Config
+	addr := fs.String("addr", "127.0.0.1:8545", "Address to listen on")
+	fs.StringVar(&config.Network, "network", "privnet", "Network of the chain: "+strings.Join(networkNames(), ", "))
+	fs.IntVar(&config.Blocks, "blocks", 64, "Number of blocks in the DAG, genesis included")
+	fs.IntVar(&config.Mempool, "mempool", 5, "Number of pending transactions, -1 for an empty mempool")
+	fs.Int64Var(&config.Seed, "seed", 0, "Seed of the chain, the same seed gives the same chain")
+	fs.DurationVar(&config.Latency, "latency", 0, "Delay of every request")
+	fs.DurationVar(&config.Jitter, "jitter", 0, "Random extra delay of up to this much")
+	fs.Func("fault", "Fail requests, for example method=qng_getStateRoot,rate=0.5,status=503 (repeatable; keys: method, rate, delay, status, code, message, drop)", func(s string) error {
+		f, err := fakenode.ParseFault(s)
+		if err == nil {
+			config.Faults = append(config.Faults, f)
+		}
+		return err
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: qng-mcp fakenode [-addr host:port] [-network name] [-blocks n] [-seed n] [-latency d] [-fault spec]...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	srv, err := fakenode.Listen(*addr, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	defer srv.Close()
+	ex := srv.Node.Example()
+	log.Info("Serving a fake QNG node", "url", srv.URL, "network", srv.Node.Network(), "blocks", config.Blocks, "faults", len(config.Faults))
+	log.Info("Example identifiers", "block_hash", ex.BlockHash, "block_order", ex.BlockOrder, "tx_hash", ex.TxHash, "address", ex.Address)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	return 0
+}
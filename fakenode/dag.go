@@ -0,0 +1,320 @@
+package fakenode
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/Qitmeer/qng/core/address"
+	"github.com/Qitmeer/qng/crypto/ecc"
+	qparams "github.com/Qitmeer/qng/params"
+)
+
+// Amounts are in atoms, 1e8 to the MEER.
+const (
+	atomsPerCoin = 1e8
+	baseSubsidy  = 10 * atomsPerCoin
+	coinName     = "MEER"
+)
+
+// genesisTime is the time of the genesis block of every synthetic chain, so
+// that a seed always gives the same chain.
+var genesisTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// block is a block of the synthetic DAG. Its id is its order.
+type block struct {
+	order    uint64
+	hash     string
+	height   uint64
+	layer    uint64
+	weight   int64
+	blue     bool
+	parents  []*block
+	children []*block
+	time     time.Time
+	txs      []*tx
+	fees     uint64
+
+	stateRoot    string
+	evmStateRoot string
+	evmHead      string
+}
+
+// mainParent is the parent the block extends the main chain of, nil for
+// the genesis block.
+func (b *block) mainParent() *block {
+	if len(b.parents) == 0 {
+		return nil
+	}
+	return b.parents[0]
+}
+
+// outpoint is an output of a transaction.
+type outpoint struct {
+	hash  string
+	index uint32
+}
+
+// output pays amount to address.
+type output struct {
+	address string
+	amount  uint64
+}
+
+// input spends an output, with the output's value for convenience.
+type input struct {
+	outpoint
+	output
+}
+
+// tx is a transaction of the synthetic chain, confirmed in a block or
+// waiting in the mempool.
+type tx struct {
+	hash     string
+	block    *block
+	index    uint32
+	coinbase bool
+	ins      []input
+	outs     []output
+	fee      uint64
+	time     time.Time
+}
+
+// chain is the synthetic BlockDAG served by a node. It does not change
+// once built.
+type chain struct {
+	params *qparams.Params
+	seed   int64
+
+	blocks    []*block
+	byHash    map[string]*block
+	mainChain []*block
+	tips      []*block
+
+	txs   map[string]*tx
+	utxos map[outpoint]output
+	// unspent lists the confirmed outputs no transaction spends yet, in a
+	// stable order
+	unspent   []outpoint
+	spentBy   map[outpoint]*tx
+	mempool   []*tx
+	addresses []string
+	byAddress map[string][]*tx
+	subsidy   uint64
+}
+
+// hashOf returns a deterministic hash for the parts.
+func hashOf(seed int64, parts ...interface{}) string {
+	h := sha256.New()
+	fmt.Fprint(h, seed)
+	for _, p := range parts {
+		fmt.Fprintf(h, "/%v", p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildChain generates a DAG of n blocks with a mempool of pending
+// transactions from seed.
+func buildChain(params *qparams.Params, seed int64, n, pending int) (*chain, error) {
+	c := &chain{
+		params:    params,
+		seed:      seed,
+		byHash:    make(map[string]*block),
+		txs:       make(map[string]*tx),
+		utxos:     make(map[outpoint]output),
+		spentBy:   make(map[outpoint]*tx),
+		byAddress: make(map[string][]*tx),
+	}
+	for i := 0; i < 8; i++ {
+		pkHash := sha256.Sum256([]byte(hashOf(seed, "address", i)))
+		addr, err := address.NewPubKeyHashAddress(pkHash[:20], params, ecc.ECDSA_Secp256k1)
+		if err != nil {
+			return nil, err
+		}
+		c.addresses = append(c.addresses, addr.String())
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	genesis := &block{hash: params.GenesisHash.String(), blue: true, weight: 1, time: genesisTime}
+	c.addBlock(genesis)
+	c.tips = []*block{genesis}
+	for len(c.blocks) < n {
+		parents := c.tips
+		main := c.newBlock(rng, parents, true)
+		c.tips = []*block{main}
+		// a sibling mined at the same time forks the DAG until the next
+		// block merges it
+		if rng.Float64() < 0.25 && len(c.blocks) < n {
+			side := c.newBlock(rng, parents, rng.Float64() < 0.5)
+			c.tips = append(c.tips, side)
+		}
+	}
+	for i := 0; i < pending; i++ {
+		if t := c.newTransfer(rng, nil, c.blocks[len(c.blocks)-1].time); t != nil {
+			c.mempool = append(c.mempool, t)
+		}
+	}
+	return c, nil
+}
+
+// newBlock mines a block on parents, the first of which is its main parent.
+// A block that is not blue is red and left off the main chain.
+func (c *chain) newBlock(rng *rand.Rand, parents []*block, blue bool) *block {
+	order := uint64(len(c.blocks))
+	main := parents[0]
+	b := &block{
+		order:   order,
+		hash:    hashOf(c.seed, "block", order),
+		height:  main.height + 1,
+		blue:    blue,
+		parents: parents,
+		time:    genesisTime.Add(time.Duration(order) * c.params.TargetTimePerBlock),
+	}
+	for _, p := range parents {
+		if p.layer+1 > b.layer {
+			b.layer = p.layer + 1
+		}
+		p.children = append(p.children, b)
+	}
+	b.weight = main.weight
+	for _, p := range parents {
+		if p.blue {
+			b.weight++
+		}
+	}
+	b.stateRoot = hashOf(c.seed, "stateroot", order)
+	b.evmStateRoot = hashOf(c.seed, "evmstateroot", b.height)
+	b.evmHead = hashOf(c.seed, "evmhead", b.height)
+
+	coinbase := &tx{hash: hashOf(c.seed, "coinbase", order), block: b, coinbase: true, time: b.time}
+	b.txs = append(b.txs, coinbase)
+	// red blocks only pay their miner
+	if blue {
+		for i, k := 0, rng.Intn(4); i < k; i++ {
+			if t := c.newTransfer(rng, b, b.time); t != nil {
+				t.index = uint32(len(b.txs))
+				b.txs = append(b.txs, t)
+				b.fees += t.fee
+			}
+		}
+	}
+	miner := c.addresses[rng.Intn(len(c.addresses))]
+	coinbase.outs = []output{{address: miner, amount: baseSubsidy + b.fees}}
+	c.subsidy += baseSubsidy
+	c.addTx(coinbase)
+	c.addBlock(b)
+	return b
+}
+
+// newTransfer spends a random confirmed output to another address with
+// change, confirmed in b or pending if b is nil. It returns nil if no
+// output is left to spend.
+func (c *chain) newTransfer(rng *rand.Rand, b *block, at time.Time) *tx {
+	if len(c.unspent) == 0 {
+		return nil
+	}
+	i := rng.Intn(len(c.unspent))
+	op := c.unspent[i]
+	prev := c.utxos[op]
+	fee := uint64(1000 + rng.Intn(9000))
+	if prev.amount <= 2*fee {
+		return nil
+	}
+	c.unspent[i] = c.unspent[len(c.unspent)-1]
+	c.unspent = c.unspent[:len(c.unspent)-1]
+	paid := (prev.amount - fee) / uint64(2+rng.Intn(8))
+	to := c.addresses[rng.Intn(len(c.addresses))]
+	t := &tx{
+		hash:  hashOf(c.seed, "tx", len(c.txs)),
+		block: b,
+		ins:   []input{{outpoint: op, output: prev}},
+		outs:  []output{{address: to, amount: paid}, {address: prev.address, amount: prev.amount - fee - paid}},
+		fee:   fee,
+		time:  at,
+	}
+	c.spentBy[op] = t
+	if b != nil {
+		delete(c.utxos, op)
+	}
+	c.addTx(t)
+	return t
+}
+
+func (c *chain) addBlock(b *block) {
+	c.blocks = append(c.blocks, b)
+	c.byHash[b.hash] = b
+	if b.blue && (len(c.mainChain) == 0 || b.mainParent() == c.mainChain[len(c.mainChain)-1]) {
+		c.mainChain = append(c.mainChain, b)
+	}
+}
+
+// addTx indexes t and adds the outputs of confirmed transactions to the
+// UTXO set.
+func (c *chain) addTx(t *tx) {
+	c.txs[t.hash] = t
+	seen := make(map[string]bool)
+	for _, in := range t.ins {
+		if !seen[in.address] {
+			seen[in.address] = true
+			c.byAddress[in.address] = append(c.byAddress[in.address], t)
+		}
+	}
+	for i, out := range t.outs {
+		if t.block != nil {
+			op := outpoint{t.hash, uint32(i)}
+			c.utxos[op] = out
+			c.unspent = append(c.unspent, op)
+		}
+		if !seen[out.address] {
+			seen[out.address] = true
+			c.byAddress[out.address] = append(c.byAddress[out.address], t)
+		}
+	}
+}
+
+// bestBlock is the tip of the main chain.
+func (c *chain) bestBlock() *block {
+	return c.mainChain[len(c.mainChain)-1]
+}
+
+// confirmations counts the blocks ordered after b, b included.
+func (c *chain) confirmations(b *block) int64 {
+	return int64(len(c.blocks)) - int64(b.order)
+}
+
+// serialize returns a stable binary encoding of t. It is not the node's
+// wire format, only a stand-in for raw transaction hex.
+func (t *tx) serialize() string {
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+	buf = append(buf, byte(len(t.ins)))
+	for _, in := range t.ins {
+		h, _ := hex.DecodeString(in.hash)
+		buf = append(buf, h...)
+		buf = binary.LittleEndian.AppendUint32(buf, in.index)
+	}
+	buf = append(buf, byte(len(t.outs)))
+	for _, out := range t.outs {
+		buf = binary.LittleEndian.AppendUint64(buf, out.amount)
+		buf = append(buf, out.address...)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// serialize returns a stable binary encoding of the header of b, a stand-in
+// for raw block hex.
+func (b *block) serialize() string {
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, 1)
+	for _, p := range b.parents {
+		h, _ := hex.DecodeString(p.hash)
+		buf = append(buf, h...)
+	}
+	root, _ := hex.DecodeString(b.stateRoot)
+	buf = append(buf, root...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(b.time.Unix()))
+	return hex.EncodeToString(buf)
+}
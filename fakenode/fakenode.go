@@ -0,0 +1,423 @@
+// Package fakenode serves a simulated QNG node over JSON-RPC for tests and
+// demos. The node answers every method of the qng-mcp method catalog from a
+// synthetic BlockDAG with blue and red blocks, tips, a mempool, UTXOs and
+// state roots, generated from a seed so that runs are repeatable. Latency
+// and faults can be injected to exercise retries, failover and timeouts.
+package fakenode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	qparams "github.com/Qitmeer/qng/params"
+)
+
+// Config describes the chain a node serves and how it misbehaves.
+type Config struct {
+	// Network is one of the networks of github.com/Qitmeer/qng/params, privnet
+	// by default. It sets the genesis block, block time and addresses.
+	Network string
+	// Blocks is the number of blocks in the DAG, genesis included, 64 by
+	// default. Mempool is the number of pending transactions, 5 by default;
+	// use a negative number for an empty mempool.
+	Blocks  int
+	Mempool int
+	// Seed generates the chain. The same seed gives the same chain.
+	Seed int64
+	// Latency delays every request, plus a random part of up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Faults fail some requests, the first matching fault that fires wins.
+	Faults []Fault
+}
+
+// Fault fails requests for a method. A fault answers with an HTTP status,
+// a JSON-RPC error, or by dropping the connection, after an optional delay.
+type Fault struct {
+	// Method is the JSON-RPC method the fault applies to, every method if
+	// empty. A batch matches if any of its requests does.
+	Method string
+	// Rate is the fraction of matching requests that fail, all of them if 0.
+	Rate float64
+	// Delay holds matching requests before they fail, or before they are
+	// answered if nothing else is set.
+	Delay time.Duration
+	// Status answers with this HTTP status.
+	Status int
+	// Code and Message answer with a JSON-RPC error, "injected fault" if
+	// Message is empty.
+	Code    int
+	Message string
+	// Drop closes the connection without an answer.
+	Drop bool
+}
+
+// ParseFault parses a fault written as comma separated key=value pairs, for
+// example "method=qng_getStateRoot,rate=0.5,status=503". The keys are the
+// lower-case field names of Fault.
+func ParseFault(s string) (Fault, error) {
+	var f Fault
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return f, fmt.Errorf("fault %q: expected key=value, got %q", s, pair)
+		}
+		var err error
+		switch key {
+		case "method":
+			f.Method = value
+		case "rate":
+			f.Rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (f.Rate < 0 || f.Rate > 1) {
+				err = fmt.Errorf("not between 0 and 1")
+			}
+		case "delay":
+			f.Delay, err = time.ParseDuration(value)
+		case "status":
+			f.Status, err = strconv.Atoi(value)
+		case "code":
+			f.Code, err = strconv.Atoi(value)
+		case "message":
+			f.Message = value
+		case "drop":
+			f.Drop, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return f, fmt.Errorf("fault %q: %s: %v", s, key, err)
+		}
+	}
+	return f, nil
+}
+
+// Node is a simulated QNG node. It is an http.Handler serving JSON-RPC
+// requests and batches.
+type Node struct {
+	config Config
+	chain  *chain
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	calls map[string]int
+}
+
+// New builds the chain of config and returns a node serving it.
+func New(config Config) (*Node, error) {
+	if config.Network == "" {
+		config.Network = "privnet"
+	}
+	if config.Blocks == 0 {
+		config.Blocks = 64
+	}
+	if config.Mempool == 0 {
+		config.Mempool = 5
+	}
+	if config.Blocks < 2 {
+		return nil, fmt.Errorf("a chain needs at least 2 blocks, got %d", config.Blocks)
+	}
+	var params *qparams.Params
+	var names []string
+	for _, p := range qparams.AllNetParams {
+		names = append(names, p.Name)
+		if p.Name == config.Network {
+			params = p.Params
+		}
+	}
+	if params == nil {
+		return nil, fmt.Errorf("unknown network %q, expected one of %s", config.Network, strings.Join(names, ", "))
+	}
+	for _, f := range config.Faults {
+		if f.Rate < 0 || f.Rate > 1 {
+			return nil, fmt.Errorf("fault rate %v is not between 0 and 1", f.Rate)
+		}
+	}
+	c, err := buildChain(params, config.Seed, config.Blocks, config.Mempool)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{
+		config: config,
+		chain:  c,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		calls:  make(map[string]int),
+	}, nil
+}
+
+// Network returns the name of the network the node serves.
+func (n *Node) Network() string {
+	return n.config.Network
+}
+
+// Calls returns how many requests for method the node answered.
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+// Methods returns the JSON-RPC methods the node serves, sorted.
+func Methods() []string {
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Example holds identifiers of the chain to build calls with.
+type Example struct {
+	BlockHash  string
+	BlockOrder uint64
+	// RedBlockHash is a red block, empty if the DAG has none.
+	RedBlockHash string
+	TxHash       string
+	// MempoolTxHash is a pending transaction, empty if the mempool is
+	// empty.
+	MempoolTxHash string
+	Address       string
+}
+
+// Example returns identifiers of the chain: the best block, a transfer
+// confirmed in it or the block before, and the address it paid.
+func (n *Node) Example() Example {
+	c := n.chain
+	best := c.bestBlock()
+	e := Example{BlockHash: best.hash, BlockOrder: best.order}
+	for _, b := range c.blocks {
+		if !b.blue && e.RedBlockHash == "" {
+			e.RedBlockHash = b.hash
+		}
+	}
+	for i := len(c.blocks) - 1; i >= 0 && e.TxHash == ""; i-- {
+		for _, t := range c.blocks[i].txs {
+			if !t.coinbase {
+				e.TxHash, e.Address = t.hash, t.outs[0].address
+				break
+			}
+		}
+	}
+	if e.TxHash == "" {
+		coinbase := best.txs[0]
+		e.TxHash, e.Address = coinbase.hash, coinbase.outs[0].address
+	}
+	if len(c.mempool) > 0 {
+		e.MempoolTxHash = c.mempool[0].hash
+	}
+	return e
+}
+
+// request is a JSON-RPC request.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// response is a JSON-RPC response.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// ServeHTTP answers a JSON-RPC request or batch.
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trimmed := bytes.TrimSpace(body)
+	batch := len(trimmed) > 0 && trimmed[0] == '['
+	var reqs []request
+	if batch {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		reqs = make([]request, 1)
+		err = json.Unmarshal(body, &reqs[0])
+	}
+	if err != nil {
+		writeJSON(w, response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32700, Message: "Parse error: " + err.Error()}})
+		return
+	}
+
+	if !n.wait(r.Context(), n.latency()) {
+		return
+	}
+	fault := n.fault(reqs)
+	if fault != nil {
+		if !n.wait(r.Context(), fault.Delay) {
+			return
+		}
+		switch {
+		case fault.Drop:
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		case fault.Status != 0:
+			http.Error(w, http.StatusText(fault.Status), fault.Status)
+			return
+		}
+	}
+
+	resps := make([]response, 0, len(reqs))
+	for _, req := range reqs {
+		resp := response{JSONRPC: "2.0", ID: req.ID}
+		if resp.ID == nil {
+			resp.ID = json.RawMessage("null")
+		}
+		if fault != nil && fault.Code != 0 && (fault.Method == "" || fault.Method == req.Method) {
+			msg := fault.Message
+			if msg == "" {
+				msg = "injected fault"
+			}
+			resp.Error = &Error{Code: fault.Code, Message: msg}
+		} else {
+			resp.Result, resp.Error = n.call(req)
+		}
+		resps = append(resps, resp)
+	}
+	if batch {
+		writeJSON(w, resps)
+		return
+	}
+	writeJSON(w, resps[0])
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// call answers req from the chain.
+func (n *Node) call(req request) (interface{}, *Error) {
+	h, ok := handlers[req.Method]
+	if !ok {
+		return nil, &Error{Code: codeMethodNotFound, Message: fmt.Sprintf("Method not found: %s", req.Method)}
+	}
+	var params []interface{}
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams("params must be an array")
+		}
+	}
+	n.mu.Lock()
+	n.calls[req.Method]++
+	n.mu.Unlock()
+	result, rpcErr := h(n, args(params))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if result == nil {
+		// keep a null result in the response
+		return json.RawMessage("null"), nil
+	}
+	return result, nil
+}
+
+// latency returns the delay of a request.
+func (n *Node) latency() time.Duration {
+	d := n.config.Latency
+	if n.config.Jitter > 0 {
+		n.mu.Lock()
+		d += time.Duration(n.rng.Int63n(int64(n.config.Jitter)))
+		n.mu.Unlock()
+	}
+	return d
+}
+
+// fault returns the fault that fires for reqs, or nil.
+func (n *Node) fault(reqs []request) *Fault {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range n.config.Faults {
+		f := &n.config.Faults[i]
+		match := f.Method == ""
+		for _, req := range reqs {
+			match = match || req.Method == f.Method
+		}
+		if match && (f.Rate == 0 || n.rng.Float64() < f.Rate) {
+			return f
+		}
+	}
+	return nil
+}
+
+// wait sleeps for d and reports whether the request is still wanted.
+func (n *Node) wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Server is a node served over HTTP by an httptest.Server.
+type Server struct {
+	*httptest.Server
+	Node *Node
+}
+
+// NewServer starts a node for config on a local port. Close it when done.
+func NewServer(config Config) (*Server, error) {
+	return Listen("", config)
+}
+
+// Listen starts a node for config on addr, a local port if addr is empty.
+func Listen(addr string, config Config) (*Server, error) {
+	node, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	srv := httptest.NewUnstartedServer(node)
+	if addr != "" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		srv.Listener.Close()
+		srv.Listener = l
+	}
+	srv.Start()
+	return &Server{Server: srv, Node: node}, nil
+}
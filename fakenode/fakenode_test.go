@@ -0,0 +1,232 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// post sends body to srv and decodes the answer into v.
+func post(t *testing.T, srv *Server, body string, v interface{}) *http.Response {
+	t.Helper()
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+type testResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// call sends a JSON-RPC request to srv.
+func call(t *testing.T, srv *Server, method string, params ...interface{}) testResponse {
+	t.Helper()
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	var resp testResponse
+	post(t, srv, string(body), &resp)
+	return resp
+}
+
+func TestChain(t *testing.T) {
+	n, err := New(Config{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := n.chain
+	if len(c.blocks) != 64 || len(c.mempool) != 5 {
+		t.Fatalf("Expected 64 blocks and 5 pending transactions, got %d and %d", len(c.blocks), len(c.mempool))
+	}
+	if c.blocks[0].hash != c.params.GenesisHash.String() {
+		t.Error("Expected the genesis block of the network")
+	}
+	red := 0
+	for _, b := range c.blocks[1:] {
+		for _, p := range b.parents {
+			if p.order >= b.order {
+				t.Errorf("Block %d has parent %d ordered after it", b.order, p.order)
+			}
+		}
+		if !b.blue {
+			red++
+		}
+	}
+	if red == 0 {
+		t.Error("Expected red blocks in the DAG")
+	}
+	for i, b := range c.mainChain {
+		if !b.blue || b.height != uint64(i) {
+			t.Errorf("Main chain block %d has height %d, blue %v", i, b.height, b.blue)
+		}
+	}
+	for _, b := range c.tips {
+		if len(b.children) != 0 {
+			t.Errorf("Tip %d has children", b.order)
+		}
+	}
+	for op, spender := range c.spentBy {
+		if _, unspent := c.utxos[op]; unspent && spender.block != nil {
+			t.Errorf("Output %v spent in block %d is still unspent", op, spender.block.order)
+		}
+	}
+
+	again, err := New(Config{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Example() != n.Example() {
+		t.Error("Expected a seed to give the same chain")
+	}
+	other, err := New(Config{Seed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Example().TxHash == n.Example().TxHash {
+		t.Error("Expected another seed to give another chain")
+	}
+	if _, err := New(Config{Network: "moonnet"}); err == nil {
+		t.Error("Expected an unknown network to be rejected")
+	}
+}
+
+func TestServe(t *testing.T) {
+	srv, err := NewServer(Config{Network: "testnet", Blocks: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ex := srv.Node.Example()
+
+	if resp := call(t, srv, "qng_getBlockCount"); string(resp.Result) != "20" {
+		t.Errorf("Expected 20 blocks, got %s", resp.Result)
+	}
+	var info struct {
+		Network string `json:"network"`
+	}
+	if resp := call(t, srv, "qng_getNodeInfo"); json.Unmarshal(resp.Result, &info) != nil || info.Network != "testnet" {
+		t.Errorf("Expected the node to serve testnet, got %s", resp.Result)
+	}
+	var block struct {
+		Hash         string `json:"hash"`
+		Order        uint64 `json:"order"`
+		Transactions []struct {
+			Txid string `json:"txid"`
+		} `json:"transactions"`
+	}
+	resp := call(t, srv, "qng_getBlockByOrder", ex.BlockOrder, true)
+	if err := json.Unmarshal(resp.Result, &block); err != nil || block.Hash != ex.BlockHash || len(block.Transactions) == 0 {
+		t.Errorf("Unexpected block %s: %v", resp.Result, err)
+	}
+	if resp := call(t, srv, "qng_getBlockByOrder", 20); resp.Error == nil || resp.Error.Code != codeBlockNotFound {
+		t.Errorf("Expected a missing block, got %+v", resp.Error)
+	}
+	if resp := call(t, srv, "qng_isBlue", "xyz"); resp.Error == nil || resp.Error.Code != codeDecodeHex {
+		t.Errorf("Expected a bad hash to be rejected, got %+v", resp.Error)
+	}
+	if resp := call(t, srv, "qng_getBlockWeight"); resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Errorf("Expected a missing param to be rejected, got %+v", resp.Error)
+	}
+	if resp := call(t, srv, "qng_nope"); resp.Error == nil || resp.Error.Code != codeMethodNotFound {
+		t.Errorf("Expected an unknown method, got %+v", resp.Error)
+	}
+	var txs []json.RawMessage
+	if resp := call(t, srv, "qng_getRawTransactions", ex.Address); json.Unmarshal(resp.Result, &txs) != nil || len(txs) == 0 {
+		t.Errorf("Expected transactions of %s, got %s", ex.Address, resp.Result)
+	}
+
+	// an output spent by a pending transaction is gone unless the mempool
+	// is left out
+	pending := srv.Node.chain.txs[ex.MempoolTxHash]
+	in := pending.ins[0]
+	if resp := call(t, srv, "qng_getUtxo", in.hash, in.index, true); string(resp.Result) != "null" {
+		t.Errorf("Expected an output spent in the mempool to be gone, got %s", resp.Result)
+	}
+	if resp := call(t, srv, "qng_getUtxo", in.hash, in.index, false); string(resp.Result) == "null" {
+		t.Error("Expected an output spent in the mempool to be unspent on chain")
+	}
+	if resp := call(t, srv, "qng_getUtxo", ex.MempoolTxHash, 0, false); string(resp.Result) != "null" {
+		t.Errorf("Expected a pending output to be left out, got %s", resp.Result)
+	}
+
+	var batch []testResponse
+	post(t, srv, `[{"jsonrpc":"2.0","id":1,"method":"qng_getBlockCount"},{"jsonrpc":"2.0","id":2,"method":"qng_getMempoolCount"}]`, &batch)
+	if len(batch) != 2 || batch[0].ID != 1 || string(batch[1].Result) != "5" {
+		t.Errorf("Unexpected batch answer %+v", batch)
+	}
+	if n := srv.Node.Calls("qng_getBlockCount"); n != 2 {
+		t.Errorf("Expected 2 calls of qng_getBlockCount, got %d", n)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	srv, err := NewServer(Config{
+		Latency: 20 * time.Millisecond,
+		Faults: []Fault{
+			{Method: "qng_getStateRoot", Status: http.StatusServiceUnavailable},
+			{Method: "qng_getBlockCount", Code: -32603, Message: "database busy"},
+			{Method: "qng_getNodeInfo", Drop: true},
+			{Method: "qng_tips", Rate: 0.5, Status: http.StatusTooManyRequests},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	start := time.Now()
+	if resp := call(t, srv, "qng_getMempoolCount"); resp.Error != nil {
+		t.Fatal(resp.Error)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("Expected a request to take at least the latency, took %s", d)
+	}
+	if resp := post(t, srv, `{"jsonrpc":"2.0","id":1,"method":"qng_getStateRoot","params":[1]}`, nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+	if resp := call(t, srv, "qng_getBlockCount"); resp.Error == nil || resp.Error.Message != "database busy" {
+		t.Errorf("Expected the injected error, got %+v", resp.Error)
+	}
+	if _, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"qng_getNodeInfo"}`)); err == nil {
+		t.Error("Expected the connection to be dropped")
+	}
+	limited := 0
+	for i := 0; i < 40; i++ {
+		if post(t, srv, `{"jsonrpc":"2.0","id":1,"method":"qng_tips"}`, nil).StatusCode == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited == 0 || limited == 40 {
+		t.Errorf("Expected about half of the requests to fail, %d of 40 did", limited)
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	f, err := ParseFault("method=qng_getStateRoot, rate=0.25,delay=2s,code=-32603,message=busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fault{Method: "qng_getStateRoot", Rate: 0.25, Delay: 2 * time.Second, Code: -32603, Message: "busy"}
+	if f != want {
+		t.Errorf("Expected %+v, got %+v", want, f)
+	}
+	for _, bad := range []string{"rate=2", "status", "colour=red", "delay=soon"} {
+		if _, err := ParseFault(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
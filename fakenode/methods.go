@@ -0,0 +1,863 @@
+package fakenode
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	qjson "github.com/Qitmeer/qng/core/json"
+)
+
+// JSON-RPC error codes of QNG nodes.
+const (
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeDecodeHex      = -32701
+	codeBlockNotFound  = -32002
+	// codeNoInfo is returned for unknown transactions and addresses.
+	codeNoInfo = -5
+)
+
+// powName names the proof of work of the synthetic blocks, MeerXKeccakV1.
+const (
+	powType = 8
+	powName = "meer_xkeccak_v1"
+	powBits = "1d00ffff"
+)
+
+// handler answers a JSON-RPC method from the chain of a node.
+type handler func(n *Node, a args) (interface{}, *Error)
+
+// handlers are the methods a node serves. They are set in init because
+// qng_getRpcInfo lists them.
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"rpc_modules":                 getRpcModules,
+		"qng_getRpcModules":           getRpcModules,
+		"qng_getBlockByOrder":         getBlockByOrder,
+		"qng_getBlockByID":            getBlockByID,
+		"qng_getBlockByNum":           getBlockByNum,
+		"qng_getBlockCount":           getBlockCount,
+		"qng_getBlockTotal":           getBlockCount,
+		"qng_getMainChainHeight":      getMainChainHeight,
+		"qng_getBestBlockHash":        getBestBlockHash,
+		"qng_getOrphansTotal":         getOrphansTotal,
+		"qng_isCurrent":               isCurrent,
+		"qng_tips":                    tips,
+		"qng_getStateRoot":            getStateRoot,
+		"qng_getBlockWeight":          getBlockWeight,
+		"qng_isBlue":                  isBlue,
+		"qng_getCoinbase":             getCoinbase,
+		"qng_getFees":                 getFees,
+		"qng_getMempool":              getMempool,
+		"qng_getMempoolCount":         getMempoolCount,
+		"qng_estimateFee":             estimateFee,
+		"qng_getBlockTemplate":        getBlockTemplate,
+		"qng_getRawTransaction":       getRawTransaction,
+		"qng_getRawTransactionByHash": getRawTransaction,
+		"qng_getRawTransactions":      getRawTransactions,
+		"qng_getUtxo":                 getUtxo,
+		"qng_getNodeInfo":             getNodeInfo,
+		"qng_getPeerInfo":             getPeerInfo,
+		"qng_getRpcInfo":              getRpcInfo,
+		"qng_getTimeInfo":             getTimeInfo,
+		"qng_getNetworkInfo":          getNetworkInfo,
+		"qng_getSubsidy":              getSubsidy,
+		"qng_banlist":                 banlist,
+		"qng_getTokenInfo":            getTokenInfo,
+	}
+}
+
+// args are the positional params of a request.
+type args []interface{}
+
+func invalidParams(format string, a ...interface{}) *Error {
+	return &Error{Code: codeInvalidParams, Message: "Invalid parameters: " + fmt.Sprintf(format, a...)}
+}
+
+func (a args) missing(i int) bool {
+	return i >= len(a) || a[i] == nil
+}
+
+// uint returns param i as an unsigned integer, def if it is missing.
+func (a args) uint(i int, name string, def uint64, required bool) (uint64, *Error) {
+	if a.missing(i) {
+		if required {
+			return 0, invalidParams("missing %s", name)
+		}
+		return def, nil
+	}
+	f, ok := a[i].(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, invalidParams("%s must be a non-negative integer", name)
+	}
+	return uint64(f), nil
+}
+
+// bool returns param i as a boolean, def if it is missing.
+func (a args) bool(i int, name string, def bool) (bool, *Error) {
+	if a.missing(i) {
+		return def, nil
+	}
+	b, ok := a[i].(bool)
+	if !ok {
+		return false, invalidParams("%s must be a boolean", name)
+	}
+	return b, nil
+}
+
+// string returns param i as a string, def if it is missing.
+func (a args) string(i int, name string, def string, required bool) (string, *Error) {
+	if a.missing(i) {
+		if required {
+			return "", invalidParams("missing %s", name)
+		}
+		return def, nil
+	}
+	s, ok := a[i].(string)
+	if !ok {
+		return "", invalidParams("%s must be a string", name)
+	}
+	return s, nil
+}
+
+// hash returns param i as a hash of 64 hex characters.
+func (a args) hash(i int, name string) (string, *Error) {
+	s, err := a.string(i, name, "", true)
+	if err != nil {
+		return "", err
+	}
+	s = strings.ToLower(strings.TrimPrefix(s, "0x"))
+	if _, decodeErr := hex.DecodeString(s); decodeErr != nil || len(s) != 64 {
+		return "", &Error{Code: codeDecodeHex, Message: fmt.Sprintf("Invalid hex for %s: %q", name, a[i])}
+	}
+	return s, nil
+}
+
+// strings returns param i as a list of strings.
+func (a args) strings(i int, name string) ([]string, *Error) {
+	if a.missing(i) {
+		return nil, nil
+	}
+	list, ok := a[i].([]interface{})
+	if !ok {
+		return nil, invalidParams("%s must be an array", name)
+	}
+	out := make([]string, len(list))
+	for j, v := range list {
+		if out[j], ok = v.(string); !ok {
+			return nil, invalidParams("%s must be an array of strings", name)
+		}
+	}
+	return out, nil
+}
+
+func blockNotFound(what interface{}) *Error {
+	return &Error{Code: codeBlockNotFound, Message: fmt.Sprintf("Block not found: %v", what)}
+}
+
+// blockArg returns the block of the hash param i.
+func (n *Node) blockArg(a args, i int) (*block, *Error) {
+	hash, err := a.hash(i, "block_hash")
+	if err != nil {
+		return nil, err
+	}
+	b, ok := n.chain.byHash[hash]
+	if !ok {
+		return nil, blockNotFound(hash)
+	}
+	return b, nil
+}
+
+// txArg returns the transaction of the hash param i.
+func (n *Node) txArg(a args, i int) (*tx, *Error) {
+	hash, err := a.hash(i, "tx_hash")
+	if err != nil {
+		return nil, err
+	}
+	t, ok := n.chain.txs[hash]
+	if !ok {
+		return nil, &Error{Code: codeNoInfo, Message: fmt.Sprintf("No information available about transaction %s: not found", hash)}
+	}
+	return t, nil
+}
+
+func coins(atoms uint64) float64 {
+	return float64(atoms) / atomsPerCoin
+}
+
+func getRpcModules(n *Node, a args) (interface{}, *Error) {
+	return map[string]string{"qng": "1.0"}, nil
+}
+
+// blockResult encodes b like qng_getBlockByOrder. Params after the first
+// are verbose, incl_tx and full_tx.
+func (n *Node) blockResult(b *block, a args, fullTxDefault bool) (interface{}, *Error) {
+	verbose, err := a.bool(1, "verbose", true)
+	if err != nil {
+		return nil, err
+	}
+	inclTx, err := a.bool(2, "incl_tx", true)
+	if err != nil {
+		return nil, err
+	}
+	fullTx, err := a.bool(3, "full_tx", fullTxDefault)
+	if err != nil {
+		return nil, err
+	}
+	if !verbose {
+		return b.serialize(), nil
+	}
+	parents := make([]string, len(b.parents))
+	for i, p := range b.parents {
+		parents[i] = p.hash
+	}
+	children := make([]string, len(b.children))
+	for i, c := range b.children {
+		children[i] = c.hash
+	}
+	parentRoot := ""
+	if p := b.mainParent(); p != nil {
+		parentRoot = p.stateRoot
+	}
+	result := qjson.BlockResult{
+		Hash:          b.hash,
+		Txsvalid:      true,
+		Confirmations: n.chain.confirmations(b),
+		Version:       1,
+		Weight:        b.weight,
+		Height:        int64(b.height),
+		TxRoot:        hashOf(n.chain.seed, "txroot", b.order),
+		Order:         int64(b.order),
+		TxFee:         int64(b.fees),
+		StateRoot:     b.stateRoot,
+		Bits:          powBits,
+		Difficulty:    0x1d00ffff,
+		PowResult:     qjson.PowResult{PowName: powName, PowType: powType, Nonce: b.order * 7919},
+		Time:          b.time.Format(time.RFC3339),
+		ParentRoot:    parentRoot,
+		Parents:       parents,
+		Children:      children,
+	}
+	if !inclTx {
+		return result, nil
+	}
+	if !fullTx {
+		for _, t := range b.txs {
+			result.Tx = append(result.Tx, t.hash)
+		}
+		return result, nil
+	}
+	txs := make([]qjson.TxRawResult, len(b.txs))
+	for i, t := range b.txs {
+		txs[i] = n.txResult(t)
+	}
+	return qjson.BlockVerboseResult{
+		Hash:          result.Hash,
+		Txsvalid:      result.Txsvalid,
+		Confirmations: result.Confirmations,
+		Version:       result.Version,
+		Weight:        result.Weight,
+		Height:        result.Height,
+		TxRoot:        result.TxRoot,
+		Order:         result.Order,
+		Tx:            txs,
+		TxFee:         result.TxFee,
+		StateRoot:     result.StateRoot,
+		Bits:          result.Bits,
+		Difficulty:    result.Difficulty,
+		PowResult:     result.PowResult,
+		Time:          result.Time,
+		ParentRoot:    result.ParentRoot,
+		Parents:       result.Parents,
+		Children:      result.Children,
+	}, nil
+}
+
+func (n *Node) blockByOrder(a args, name string) (*block, *Error) {
+	order, err := a.uint(0, name, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if order >= uint64(len(n.chain.blocks)) {
+		return nil, blockNotFound(order)
+	}
+	return n.chain.blocks[order], nil
+}
+
+func getBlockByOrder(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockByOrder(a, "block_order")
+	if err != nil {
+		return nil, err
+	}
+	return n.blockResult(b, a, true)
+}
+
+// getBlockByID answers qng_getBlockByID. Block ids are orders in the
+// synthetic DAG.
+func getBlockByID(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockByOrder(a, "block_id")
+	if err != nil {
+		return nil, err
+	}
+	return n.blockResult(b, a, false)
+}
+
+func getBlockByNum(n *Node, a args) (interface{}, *Error) {
+	num, err := a.uint(0, "block_number", 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if num >= uint64(len(n.chain.mainChain)) {
+		return nil, blockNotFound(num)
+	}
+	return n.blockResult(n.chain.mainChain[num], a, false)
+}
+
+func getBlockCount(n *Node, a args) (interface{}, *Error) {
+	return len(n.chain.blocks), nil
+}
+
+func getMainChainHeight(n *Node, a args) (interface{}, *Error) {
+	return n.chain.bestBlock().height, nil
+}
+
+func getBestBlockHash(n *Node, a args) (interface{}, *Error) {
+	return n.chain.bestBlock().hash, nil
+}
+
+func getOrphansTotal(n *Node, a args) (interface{}, *Error) {
+	return 0, nil
+}
+
+func isCurrent(n *Node, a args) (interface{}, *Error) {
+	return true, nil
+}
+
+func tips(n *Node, a args) (interface{}, *Error) {
+	info := qjson.TipsInfo{Count: len(n.chain.tips), Valid: []qjson.TipInfo{}}
+	for _, b := range n.chain.tips {
+		info.Valid = append(info.Valid, qjson.TipInfo{ID: b.order, Hash: b.hash, Height: b.height})
+	}
+	return info, nil
+}
+
+func getStateRoot(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockByOrder(a, "block_order")
+	if err != nil {
+		return nil, err
+	}
+	verbose, err := a.bool(1, "verbose", true)
+	if err != nil {
+		return nil, err
+	}
+	if !verbose {
+		return b.stateRoot, nil
+	}
+	return map[string]interface{}{
+		"Hash":         b.hash,
+		"Order":        b.order,
+		"Height":       b.height,
+		"Valid":        b.blue,
+		"EVMStateRoot": b.evmStateRoot,
+		"EVMHeight":    b.height,
+		"EVMHead":      b.evmHead,
+		"StateRoot":    b.stateRoot,
+	}, nil
+}
+
+func getBlockWeight(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockArg(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	return b.weight, nil
+}
+
+// isBlue answers 1 for a blue block and 0 for a red one.
+func isBlue(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockArg(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	if b.blue {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func getCoinbase(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockArg(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	verbose, err := a.bool(1, "verbose", false)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.txs) == 0 {
+		return nil, &Error{Code: codeNoInfo, Message: "The genesis block has no coinbase"}
+	}
+	if !verbose {
+		return []string{b.txs[0].serialize()}, nil
+	}
+	return []qjson.TxRawResult{n.txResult(b.txs[0])}, nil
+}
+
+// getFees answers the fees a block collected by coin.
+func getFees(n *Node, a args) (interface{}, *Error) {
+	b, err := n.blockArg(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]uint64{coinName: b.fees}, nil
+}
+
+func getMempool(n *Node, a args) (interface{}, *Error) {
+	txType, err := a.string(0, "tx_type", "", false)
+	if err != nil {
+		return nil, err
+	}
+	verbose, err := a.bool(1, "verbose", false)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []string{}
+	details := make(map[string]interface{})
+	if txType == "" || txType == "TxTypeRegular" {
+		for _, t := range n.chain.mempool {
+			hashes = append(hashes, t.hash)
+			details[t.hash] = map[string]interface{}{
+				"size":   len(t.serialize()) / 2,
+				"fee":    coins(t.fee),
+				"time":   t.time.Unix(),
+				"height": n.chain.bestBlock().height,
+			}
+		}
+	}
+	if verbose {
+		return details, nil
+	}
+	return hashes, nil
+}
+
+func getMempoolCount(n *Node, a args) (interface{}, *Error) {
+	return len(n.chain.mempool), nil
+}
+
+// estimateFee answers a fee rate in MEER per kB that rises with the mempool
+// and the urgency of the caller.
+func estimateFee(n *Node, a args) (interface{}, *Error) {
+	blocks, err := a.uint(0, "num_blocks", 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if blocks == 0 {
+		return nil, invalidParams("num_blocks must be at least 1")
+	}
+	return 0.0001 * (1 + float64(len(n.chain.mempool))/float64(blocks)), nil
+}
+
+func getBlockTemplate(n *Node, a args) (interface{}, *Error) {
+	capabilities, err := a.strings(0, "capabilities")
+	if err != nil {
+		return nil, err
+	}
+	pow, err := a.uint(1, "pow_type", powType, false)
+	if err != nil {
+		return nil, err
+	}
+	c := n.chain
+	best := c.bestBlock()
+	parents := make([]qjson.GetBlockTemplateResultPt, len(c.tips))
+	for i, b := range c.tips {
+		parents[i] = qjson.GetBlockTemplateResultPt{Data: b.serialize(), Hash: b.hash}
+	}
+	txs := make([]qjson.GetBlockTemplateResultTx, len(c.mempool))
+	var fees uint64
+	for i, t := range c.mempool {
+		txs[i] = qjson.GetBlockTemplateResultTx{Data: t.serialize(), Hash: t.hash, Depends: []int64{}, Fee: int64(t.fee), SigOps: 1, Weight: int64(len(t.serialize()) * 2)}
+		fees += t.fee
+	}
+	value := baseSubsidy + fees
+	return qjson.GetBlockTemplateResult{
+		StateRoot:        hashOf(c.seed, "stateroot", len(c.blocks)),
+		CurTime:          best.time.Add(c.params.TargetTimePerBlock).Unix(),
+		Height:           int64(best.height + 1),
+		Blues:            best.weight,
+		PreviousHash:     best.hash,
+		Parents:          parents,
+		Transactions:     txs,
+		Version:          1,
+		CoinbaseValue:    &value,
+		PowDiffReference: qjson.PowDiffReference{NBits: powBits, Target: strings.Repeat("0", 8) + strings.Repeat("f", 56)},
+		WorkData:         hashOf(c.seed, "work", len(c.blocks), pow),
+		Capabilities:     capabilities,
+		BlockFeesMap:     map[int]int64{0: int64(fees)},
+		CoinbaseVersion:  "0.10.x",
+	}, nil
+}
+
+// txResult encodes t like qng_getRawTransaction.
+func (n *Node) txResult(t *tx) qjson.TxRawResult {
+	result := qjson.TxRawResult{
+		Hex:       t.serialize(),
+		Txid:      t.hash,
+		TxHash:    hashOf(n.chain.seed, "txfullhash", t.hash),
+		Size:      int32(len(t.serialize()) / 2),
+		Version:   1,
+		Timestamp: t.time.Format(time.RFC3339),
+		Txsvalid:  true,
+		Type:      "TxTypeRegular",
+	}
+	if t.coinbase {
+		result.Type = "TxTypeCoinbase"
+		result.Vin = []qjson.Vin{{Coinbase: hex.EncodeToString([]byte(fmt.Sprintf("order %d", t.block.order))), Sequence: math.MaxUint32}}
+	}
+	for _, in := range t.ins {
+		result.Vin = append(result.Vin, qjson.Vin{
+			Txid:      in.hash,
+			Vout:      in.index,
+			Sequence:  math.MaxUint32,
+			ScriptSig: &qjson.ScriptSig{Asm: "synthetic", Hex: hashOf(n.chain.seed, "sig", t.hash)},
+		})
+	}
+	for _, out := range t.outs {
+		result.Vout = append(result.Vout, qjson.Vout{
+			Coin:   coinName,
+			Amount: out.amount,
+			ScriptPubKey: qjson.ScriptPubKeyResult{
+				Asm:       "OP_DUP OP_HASH160 OP_EQUALVERIFY OP_CHECKSIG",
+				ReqSigs:   1,
+				Type:      "pubkeyhash",
+				Addresses: []string{out.address},
+			},
+		})
+	}
+	if t.block != nil {
+		result.BlockHash = t.block.hash
+		result.BlockOrder = t.block.order
+		result.TxIndex = t.index
+		result.Confirmations = n.chain.confirmations(t.block)
+		result.Time = t.time.Unix()
+		result.Blocktime = t.block.time.Unix()
+	}
+	return result
+}
+
+func getRawTransaction(n *Node, a args) (interface{}, *Error) {
+	t, err := n.txArg(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	verbose, err := a.bool(1, "verbose", false)
+	if err != nil {
+		return nil, err
+	}
+	if !verbose {
+		return t.serialize(), nil
+	}
+	return n.txResult(t), nil
+}
+
+// getUtxo answers an unspent output, or null if it is spent or unknown.
+func getUtxo(n *Node, a args) (interface{}, *Error) {
+	hash, err := a.hash(0, "tx_hash")
+	if err != nil {
+		return nil, err
+	}
+	vout, err := a.uint(1, "vout", 0, true)
+	if err != nil {
+		return nil, err
+	}
+	mempool, err := a.bool(2, "include_mempool", true)
+	if err != nil {
+		return nil, err
+	}
+	c := n.chain
+	op := outpoint{hash: hash, index: uint32(vout)}
+	t, ok := c.txs[hash]
+	if !ok || vout >= uint64(len(t.outs)) {
+		return nil, nil
+	}
+	out := t.outs[vout]
+	var confirmations int64
+	switch {
+	case t.block != nil:
+		if _, unspent := c.utxos[op]; !unspent {
+			return nil, nil
+		}
+		confirmations = c.confirmations(t.block)
+	case !mempool:
+		return nil, nil
+	}
+	if spender, spent := c.spentBy[op]; spent && (spender.block != nil || mempool) {
+		return nil, nil
+	}
+	return qjson.GetUtxoResult{
+		BestBlock:     c.bestBlock().hash,
+		Confirmations: confirmations,
+		Amount:        coins(out.amount),
+		ScriptPubKey: qjson.ScriptPubKeyResult{
+			Asm:       "OP_DUP OP_HASH160 OP_EQUALVERIFY OP_CHECKSIG",
+			ReqSigs:   1,
+			Type:      "pubkeyhash",
+			Addresses: []string{out.address},
+		},
+		Version:  1,
+		Coinbase: t.coinbase,
+	}, nil
+}
+
+func getRawTransactions(n *Node, a args) (interface{}, *Error) {
+	addr, err := a.string(0, "address", "", true)
+	if err != nil {
+		return nil, err
+	}
+	vinExtra, err := a.bool(1, "vin_extra", false)
+	if err != nil {
+		return nil, err
+	}
+	count, err := a.uint(2, "count", 100, false)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := a.uint(3, "skip", 0, false)
+	if err != nil {
+		return nil, err
+	}
+	reverse, err := a.bool(4, "reverse", false)
+	if err != nil {
+		return nil, err
+	}
+	verbose, err := a.bool(5, "verbose", true)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := a.strings(6, "filter_addrs")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(addr, n.chain.params.NetworkAddressPrefix) {
+		return nil, &Error{Code: codeNoInfo, Message: fmt.Sprintf("Invalid address or key: %s is not a %s address", addr, n.config.Network)}
+	}
+	txs := n.chain.byAddress[addr]
+	ordered := make([]*tx, len(txs))
+	copy(ordered, txs)
+	if reverse {
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+	if skip >= uint64(len(ordered)) {
+		ordered = nil
+	} else {
+		ordered = ordered[skip:]
+	}
+	if count < uint64(len(ordered)) {
+		ordered = ordered[:count]
+	}
+	wanted := func(address string) bool {
+		if len(filter) == 0 {
+			return true
+		}
+		for _, f := range filter {
+			if f == address {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !verbose {
+		hexes := make([]string, len(ordered))
+		for i, t := range ordered {
+			hexes[i] = t.serialize()
+		}
+		return hexes, nil
+	}
+	results := make([]qjson.GetRawTransactionsResult, 0, len(ordered))
+	for _, t := range ordered {
+		raw := n.txResult(t)
+		r := qjson.GetRawTransactionsResult{
+			Hex:       raw.Hex,
+			Txid:      raw.Txid,
+			Hash:      raw.TxHash,
+			Size:      fmt.Sprint(raw.Size),
+			Vsize:     fmt.Sprint(raw.Size),
+			Version:   raw.Version,
+			Vin:       []qjson.VinPrevOut{},
+			Vout:      []qjson.Vout{},
+			Time:      raw.Time,
+			Blocktime: raw.Blocktime,
+		}
+		if t.block != nil {
+			r.BlockHash = t.block.hash
+			r.Confirmations = uint64(raw.Confirmations)
+		}
+		for i, in := range t.ins {
+			if !wanted(in.address) {
+				continue
+			}
+			vin := qjson.VinPrevOut{Txid: in.hash, Vout: in.index, ScriptSig: raw.Vin[i].ScriptSig, Sequence: raw.Vin[i].Sequence}
+			if vinExtra {
+				vin.PrevOut = &qjson.PrevOut{Addresses: []string{in.address}, Value: coins(in.amount)}
+			}
+			r.Vin = append(r.Vin, vin)
+		}
+		for i, out := range t.outs {
+			if wanted(out.address) {
+				r.Vout = append(r.Vout, raw.Vout[i])
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func getNodeInfo(n *Node, a args) (interface{}, *Error) {
+	c := n.chain
+	best := c.bestBlock()
+	tipHashes := make([]string, len(c.tips))
+	for i, b := range c.tips {
+		tipHashes[i] = b.hash
+	}
+	return qjson.InfoNodeResult{
+		ID:              peerID(c.seed, 0),
+		Addresss:        []string{"/ip4/127.0.0.1/tcp/" + c.params.DefaultPort},
+		Version:         1,
+		BuildVersion:    "fakenode",
+		ProtocolVersion: 1,
+		TotalSubsidy:    c.subsidy,
+		StateRoot:       best.stateRoot,
+		GraphState: &qjson.GetGraphStateResult{
+			Tips:       tipHashes,
+			MainOrder:  uint32(best.order),
+			MainHeight: uint32(best.height),
+			Layer:      uint32(c.blocks[len(c.blocks)-1].layer),
+		},
+		PowDiff:          &qjson.PowDiff{CurrentDiff: 1},
+		Confirmations:    1,
+		CoinbaseMaturity: int32(c.params.CoinbaseMaturity),
+		Modules:          []string{"qitmeer"},
+		Network:          n.config.Network,
+		Connections:      int32(len(peers(c))),
+	}, nil
+}
+
+func peerID(seed int64, i int) string {
+	return "16Uiu2HAm" + hashOf(seed, "peer", i)[:44]
+}
+
+// peers are the synthetic peers of a node, the last one inactive.
+func peers(c *chain) []qjson.GetPeerInfoResult {
+	var result []qjson.GetPeerInfoResult
+	best := c.bestBlock()
+	for i := 1; i <= 3; i++ {
+		result = append(result, qjson.GetPeerInfoResult{
+			ID:        peerID(c.seed, i),
+			Address:   fmt.Sprintf("/ip4/10.0.0.%d/tcp/%s", i, c.params.DefaultPort),
+			State:     true,
+			Active:    i < 3,
+			Protocol:  1,
+			Genesis:   c.params.GenesisHash.String(),
+			Services:  "Full",
+			Direction: "outbound",
+			StateRoot: best.stateRoot,
+			GraphState: &qjson.GetGraphStateResult{
+				MainOrder:  uint32(best.order),
+				MainHeight: uint32(best.height),
+			},
+			Version: "fakenode",
+			Network: c.params.Name,
+		})
+	}
+	return result
+}
+
+func getPeerInfo(n *Node, a args) (interface{}, *Error) {
+	verbose, err := a.bool(0, "verbose", false)
+	if err != nil {
+		return nil, err
+	}
+	id, err := a.string(1, "peer_id", "", false)
+	if err != nil {
+		return nil, err
+	}
+	result := []qjson.GetPeerInfoResult{}
+	for _, p := range peers(n.chain) {
+		if (verbose || p.Active) && (id == "" || id == p.ID) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// getRpcInfo answers the methods of the node and how often each was
+// called.
+func getRpcInfo(n *Node, a args) (interface{}, *Error) {
+	type status struct {
+		Name       string `json:"name"`
+		TotalCalls int    `json:"totalcalls"`
+	}
+	var result []status
+	for _, name := range Methods() {
+		if strings.HasPrefix(name, "qng_") {
+			result = append(result, status{Name: name, TotalCalls: n.Calls(name)})
+		}
+	}
+	return result, nil
+}
+
+// getTimeInfo answers the clock of the chain, the time of the last block.
+func getTimeInfo(n *Node, a args) (interface{}, *Error) {
+	now := n.chain.blocks[len(n.chain.blocks)-1].time
+	return map[string]interface{}{
+		"now":    now.Format(time.RFC3339),
+		"offset": 0,
+	}, nil
+}
+
+func getNetworkInfo(n *Node, a args) (interface{}, *Error) {
+	all := peers(n.chain)
+	active := 0
+	for _, p := range all {
+		if p.Active {
+			active++
+		}
+	}
+	return qjson.NetworkStat{
+		TotalPeers:     len(all),
+		MaxConnected:   50,
+		MaxInbound:     25,
+		TotalConnected: active,
+		Infos: []*qjson.NetworkInfo{
+			{Name: "Full", Peers: len(all), Connecteds: active},
+		},
+	}, nil
+}
+
+func getSubsidy(n *Node, a args) (interface{}, *Error) {
+	return qjson.SubsidyInfo{
+		Mode:         "static",
+		TotalSubsidy: n.chain.subsidy,
+		BaseSubsidy:  baseSubsidy,
+		NextSubsidy:  baseSubsidy,
+	}, nil
+}
+
+func banlist(n *Node, a args) (interface{}, *Error) {
+	best := n.chain.bestBlock()
+	return []qjson.GetBanlistResult{{
+		PeerID: peerID(n.chain.seed, 4),
+		Bads:   []*qjson.BadResponse{{ID: 1, Time: best.time.Format(time.RFC3339), Error: "sent an invalid block"}},
+	}}, nil
+}
+
+func getTokenInfo(n *Node, a args) (interface{}, *Error) {
+	return []qjson.TokenState{{CoinId: 0, CoinName: coinName, UpLimit: math.MaxInt64, Enable: true}}, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"qng-mcp-server/fakenode"
+)
+
+// TestFakeNodeCatalog calls the tool of every catalog method against a fake
+// node and checks that the node answered each of them.
+func TestFakeNodeCatalog(t *testing.T) {
+	srv, err := fakenode.NewServer(fakenode.Config{Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ex := srv.Node.Example()
+	c := newTestClient(t, NewMCPServer(NewClient(srv.URL)))
+
+	methods, err := GetMethods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(map[string]bool)
+	for _, name := range fakenode.Methods() {
+		served[name] = true
+	}
+	// internal methods back the built-in tools
+	builtins := map[string]string{
+		"qng_getBlockByOrder": "qng_get_block_by_order",
+		"qng_getBlockCount":   "qng_get_block_count",
+		"qng_getStateRoot":    "qng_get_stateroot",
+	}
+	values := map[string]interface{}{
+		"block_order":  float64(ex.BlockOrder),
+		"block_id":     float64(ex.BlockOrder),
+		"block_number": float64(1),
+		"block_hash":   ex.BlockHash,
+		"tx_hash":      ex.TxHash,
+		"vout":         float64(0),
+		"address":      ex.Address,
+		"num_blocks":   float64(6),
+	}
+	for _, m := range methods {
+		if !served[m.Name] {
+			t.Errorf("The fake node does not serve %s", m.Name)
+			continue
+		}
+		req := mcp.CallToolRequest{}
+		req.Params.Name = m.Call
+		if m.Internal {
+			req.Params.Name = builtins[m.Name]
+			if req.Params.Name == "" {
+				t.Errorf("No built-in tool known for internal method %s", m.Name)
+				continue
+			}
+		}
+		req.Params.Arguments = map[string]interface{}{}
+		for _, p := range m.Params {
+			if !p.Required {
+				continue
+			}
+			v, ok := values[p.Name]
+			if !ok {
+				t.Fatalf("No value for required param %s of %s", p.Name, m.Name)
+			}
+			req.Params.Arguments[p.Name] = v
+		}
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Errorf("Error calling %s: %v", req.Params.Name, err)
+			continue
+		}
+		if result.IsError {
+			t.Errorf("Tool %s returned an error: %v", req.Params.Name, result.Content)
+		}
+		if srv.Node.Calls(m.Name) == 0 {
+			t.Errorf("Tool %s did not reach the node as %s", req.Params.Name, m.Name)
+		}
+	}
+
+	// the red blocks of the DAG are told apart
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "is_blue"
+	req.Params.Arguments = map[string]interface{}{"block_hash": ex.RedBlockHash}
+	result, err := c.CallTool(context.Background(), req)
+	if err != nil || result.IsError || result.Content[0].(mcp.TextContent).Text != "0" {
+		t.Errorf("Expected block %s to be red, got %v, %v", ex.RedBlockHash, result, err)
+	}
+}
+
+func TestFakeNodeFaults(t *testing.T) {
+	srv, err := fakenode.NewServer(fakenode.Config{Faults: []fakenode.Fault{
+		{Method: "qng_getBlockCount", Status: http.StatusServiceUnavailable},
+		{Method: "qng_getNodeInfo", Code: rpcCodeInvalidNode, Message: "node is not synced"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: time.Second, MaxAttempts: 1}
+	}
+	rpc := NewClient(srv.URL, WithRetryPolicy(once))
+
+	_, err = rpc.GetBlockCount(context.Background())
+	toolErr := asToolError("qng_getBlockCount", err)
+	if toolErr.Kind != ErrorUpstream || srv.Node.Calls("qng_getBlockCount") != 0 {
+		t.Errorf("Expected the node to fail with HTTP 503, got %+v", toolErr)
+	}
+	var info json.RawMessage
+	err = rpc.Call(context.Background(), "qng_getNodeInfo", nil, &info)
+	toolErr = asToolError("qng_getNodeInfo", err)
+	if toolErr.Kind != ErrorRPC || toolErr.Hint == "" {
+		t.Errorf("Expected an injected RPC error with a hint, got %+v", toolErr)
+	}
+}
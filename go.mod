@@ -5,15 +5,23 @@ go 1.23.0
 require (
 	github.com/Qitmeer/qng v1.2.0
 	github.com/mark3labs/mcp-go v0.25.0
+	go.etcd.io/bbolt v1.3.11
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/Qitmeer/crypto v0.0.0-20201028030128-6ed4040ca34a // indirect
+	github.com/Qitmeer/crypto/cryptonight v0.0.0-20201028030128-6ed4040ca34a // indirect
+	github.com/aead/skein v0.0.0-20160722084837-9365ae6e95d2 // indirect
+	github.com/dchest/blake256 v1.1.0 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/jrick/logrotate v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
+	golang.org/x/crypto v0.22.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
 )
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ipcPath returns the socket path of an ipc:///path/to/qng.ipc URL, or ""
+// if endpoint is not an IPC URL.
+func ipcPath(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "ipc" || u.Host != "" {
+		return ""
+	}
+	return u.Path
+}
+
+// ipcRoundTrip sends a request or batch over the unix domain socket at path
+// and reads one JSON value back. JSON-RPC over IPC is a plain stream of JSON
+// values, as served by geth style nodes. Every request opens a connection of
+// its own; they are cheap on a local socket and need no multiplexing.
+func ipcRoundTrip(ctx context.Context, path string, requestBody []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// unblock the read when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.Write(requestBody); err != nil {
+		return nil, ipcError(ctx, err)
+	}
+	var response json.RawMessage
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, ipcError(ctx, err)
+	}
+	return response, nil
+}
+
+// ipcError prefers the context error over the socket error it caused.
+func ipcError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if _, ok := err.(*json.SyntaxError); ok {
+		return &invalidResponseError{err}
+	}
+	if _, ok := err.(net.Error); ok {
+		return err
+	}
+	return fmt.Errorf("ipc: %w", err)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newIPCNode serves JSON-RPC on a unix socket, answering qng_getBlockCount
+// and hanging on any other method.
+func newIPCNode(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "qng.ipc")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var req JSONRPCRequest
+				if err := json.NewDecoder(conn).Decode(&req); err != nil {
+					return
+				}
+				if req.Method != "qng_getBlockCount" {
+					time.Sleep(time.Second)
+					return
+				}
+				json.NewEncoder(conn).Encode(JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("42")})
+			}()
+		}
+	}()
+	return path
+}
+
+func TestIPCTransport(t *testing.T) {
+	path := newIPCNode(t)
+	endpoints, err := ParseEndpointList("ipc://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoints[0].Name != path {
+		t.Errorf("Expected the socket path as name, got %q", endpoints[0].Name)
+	}
+	for _, bad := range []string{"ipc://", "ipc://host/qng.ipc"} {
+		if _, err := ParseEndpointList(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: 50 * time.Millisecond, MaxAttempts: 1}
+	}
+	c := NewFailoverClient(endpoints, WithRetryPolicy(once))
+	count, err := c.GetBlockCount(context.Background())
+	if err != nil || count != 42 {
+		t.Errorf("Expected block count 42, got %d, %v", count, err)
+	}
+
+	_, err = c.CallRaw(context.Background(), "qng_getNodeInfo", nil)
+	if toolErr := asToolError("qng_getNodeInfo", err); toolErr.Class != RetryTimeout {
+		t.Errorf("Expected a timeout, got %+v", toolErr)
+	}
+
+	missing := NewClient("ipc://"+filepath.Join(t.TempDir(), "missing.ipc"), WithRetryPolicy(once))
+	_, err = missing.CallRaw(context.Background(), "qng_getBlockCount", nil)
+	if toolErr := asToolError("qng_getBlockCount", err); toolErr.Kind != ErrorUpstream || toolErr.Class != RetryConnection {
+		t.Errorf("Expected a connection error, got %+v", toolErr)
+	}
+}
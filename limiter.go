@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+)
+
+// ConcurrencyConfig bounds the requests in flight to an endpoint.
+type ConcurrencyConfig struct {
+	// Max is the highest number of requests in flight. 0 means unlimited.
+	Max int
+	// Queue is the number of requests that may wait for a slot; further
+	// requests fail fast.
+	Queue int
+}
+
+// defaultConcurrencyConfig applies to endpoints of clients that do not set
+// their own. The concurrency flags update it at startup.
+var defaultConcurrencyConfig = ConcurrencyConfig{
+	Max:   16,
+	Queue: 64,
+}
+
+// limiterDecreaseInterval is the minimum time between two decreases of the
+// limit, so one burst of failures halves it only once.
+const limiterDecreaseInterval = time.Second
+
+// limiter bounds the requests in flight to an endpoint. The limit adapts:
+// it is halved when the endpoint shows signs of overload and grows by one
+// after a limit's worth of requests succeeded, up to Max.
+type limiter struct {
+	name   string
+	config ConcurrencyConfig
+
+	mu           sync.Mutex
+	limit        int
+	inflight     int
+	successes    int
+	lastDecrease time.Time
+	waiters      []chan struct{}
+}
+
+func newLimiter(name string, config ConcurrencyConfig) *limiter {
+	return &limiter{name: name, config: config, limit: config.Max}
+}
+
+// acquire takes a slot, waiting in the queue until one is free or ctx ends.
+// It fails fast with a *backoffError when the queue is full.
+func (l *limiter) acquire(ctx context.Context) error {
+	if l.config.Max <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	if l.inflight < l.limit && len(l.waiters) == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.config.Queue {
+		l.mu.Unlock()
+		return &backoffError{Endpoint: l.name, Reason: "queue_full", RetryAfter: time.Second}
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.waiters {
+			if w == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot was handed over just now, pass it on
+		l.inflight--
+		l.grant()
+		return ctx.Err()
+	}
+}
+
+// release returns a slot. overloaded reports that the request timed out or
+// was turned away by the endpoint.
+func (l *limiter) release(overloaded bool) {
+	if l.config.Max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	switch {
+	case overloaded:
+		l.successes = 0
+		if l.limit > 1 && time.Since(l.lastDecrease) >= limiterDecreaseInterval {
+			l.limit /= 2
+			l.lastDecrease = time.Now()
+			log.Debug("Concurrency limit decreased", "endpoint", l.name, "limit", l.limit)
+		}
+	case l.limit < l.config.Max:
+		if l.successes++; l.successes >= l.limit {
+			l.limit++
+			l.successes = 0
+			log.Debug("Concurrency limit increased", "endpoint", l.name, "limit", l.limit)
+		}
+	}
+	l.grant()
+}
+
+// grant hands free slots to waiting requests in order. l.mu is held.
+func (l *limiter) grant() {
+	for l.inflight < l.limit && len(l.waiters) > 0 {
+		l.inflight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// stats returns the current limit, requests in flight and queued requests.
+func (l *limiter) stats() (limit, inflight, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.inflight, len(l.waiters)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterQueue(t *testing.T) {
+	l := newLimiter("limiter-test", ConcurrencyConfig{Max: 1, Queue: 1})
+	ctx := context.Background()
+	if err := l.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	queued := make(chan error)
+	go func() { queued <- l.acquire(ctx) }()
+	for {
+		if _, _, n := l.stats(); n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var backoffErr *backoffError
+	if err := l.acquire(ctx); !errors.As(err, &backoffErr) || backoffErr.Reason != "queue_full" {
+		t.Errorf("Expected a full queue to fail fast, got %v", err)
+	}
+
+	l.release(false)
+	if err := <-queued; err != nil {
+		t.Fatalf("Expected the queued request to get the slot, got %v", err)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(cctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a queued request to give up with its context, got %v", err)
+	}
+	l.release(false)
+	if _, inflight, queued := l.stats(); inflight != 0 || queued != 0 {
+		t.Errorf("Expected an idle limiter, got %d in flight and %d queued", inflight, queued)
+	}
+}
+
+func TestLimiterAdapts(t *testing.T) {
+	l := newLimiter("limiter-test", ConcurrencyConfig{Max: 4, Queue: 1})
+	ctx := context.Background()
+
+	l.acquire(ctx)
+	l.release(true)
+	if limit, _, _ := l.stats(); limit != 2 {
+		t.Fatalf("Expected overload to halve the limit, got %d", limit)
+	}
+	// a burst of failures halves the limit only once
+	l.acquire(ctx)
+	l.release(true)
+	if limit, _, _ := l.stats(); limit != 2 {
+		t.Errorf("Expected the limit to stay at 2, got %d", limit)
+	}
+	for i := 0; i < 5; i++ {
+		l.acquire(ctx)
+		l.release(false)
+	}
+	if limit, _, _ := l.stats(); limit != 4 {
+		t.Errorf("Expected successes to restore the limit, got %d", limit)
+	}
+}
+
+func TestClientConcurrency(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-unblock
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":1}`))
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	c := NewClient(srv.URL, WithConcurrency(ConcurrencyConfig{Max: 1, Queue: 0}))
+	go c.CallRaw(context.Background(), "qng_getBlockCount", nil)
+	<-started
+
+	_, err := c.CallRaw(context.Background(), "qng_getNodeInfo", nil)
+	if toolErr := asToolError("qng_getNodeInfo", err); toolErr.Kind != ErrorUnavailable || toolErr.Class != "queue_full" {
+		t.Errorf("Expected a busy endpoint to fail fast, got %+v", toolErr)
+	}
+}
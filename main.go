@@ -1,15 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,28 +25,33 @@ var logLevel = "info"
 // current mcp server
 var currentMcpServer = "localhost:8080"
 
-// RPC timeout configuration
-var rpcTimeout = 60 * time.Second
-
-// HTTP client with timeout and connection pooling
-var httpClient = &http.Client{
-	Timeout: 60 * time.Second, // 增加全局超时到60秒
-	Transport: &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-		// 增加连接超时设置
-		TLSHandshakeTimeout:   15 * time.Second,
-		ResponseHeaderTimeout: 60 * time.Second, // 增加响应头超时到60秒
-		// 添加连接保活设置
-		DisableKeepAlives:  false,
-		MaxConnsPerHost:    20,
-		DisableCompression: false,
-	},
-}
+// method catalog file, empty means the built-in catalog
+var methodsFile = ""
+
+// probe the node at startup and merge its methods with the catalog
+var discoverMethods = false
+
+// node endpoints file, overrides -rpc when set
+var endpointsFile = ""
+
+// named networks file, overrides -rpc and -endpoints when set
+var networksFile = ""
+
+// network the tools query by default; with -rpc or -endpoints the nodes
+// must report it
+var defaultNetwork = ""
+
+// how often the endpoints are health checked, 0 disables the checks
+var healthInterval = 15 * time.Second
+
+// how many blocks an endpoint may lag behind the best one
+var maxBlockLag uint64 = 10
+
+// node events to subscribe to over a websocket endpoint
+var subscribeTopics = ""
 
-// Mutex for protecting concurrent RPC calls
-var rpcMutex sync.RWMutex
+// how often the method catalog file is checked for changes
+const methodsPollInterval = 2 * time.Second
 
 // Simple logging wrapper that can be replaced with QNG logging later
 // To use the actual QNG logging library, replace this with:
@@ -61,15 +63,15 @@ type JSONRPCRequest struct {
 	JSONRPC string        `json:"jsonrpc"`
 	Method  string        `json:"method"`
 	Params  []interface{} `json:"params"`
-	ID      int           `json:"id"`
+	ID      uint64        `json:"id"`
 }
 
 // JSONRPCResponse struct is used to parse JSON-RPC responses
 type JSONRPCResponse struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Result  interface{} `json:"result"`
-	Error   *RPCError   `json:"error"`
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
 }
 
 // RPCError struct is used to parse JSON-RPC errors
@@ -79,127 +81,6 @@ type RPCError struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-// JsonRpcResponse constructs and sends a JSON-RPC request and returns the response
-// with retry mechanism and timeout control
-func JsonRpcResponse(rpcurl, method string, params []interface{}) ([]byte, error) {
-	const maxRetries = 1
-	var retryDelay time.Duration
-
-	// 根据方法类型设置不同的重试延迟
-	if method == "qng_getStateRoot" {
-		retryDelay = 3 * time.Second // 状态根查询使用更长的重试间隔
-	} else {
-		retryDelay = 1 * time.Second
-	}
-
-	// 根据不同的RPC方法设置不同的超时时间
-	var requestTimeout time.Duration
-	switch method {
-	case "qng_getBlockByOrder", "qng_getBlockByID", "qng_getBlockByNum":
-		requestTimeout = 60 * time.Second // 区块查询需要更长时间
-	case "qng_getRawTransactions", "qng_getMempool":
-		requestTimeout = 50 * time.Second // 交易查询需要较长时间
-	case "qng_getStateRoot":
-		requestTimeout = 90 * time.Second // 状态根查询需要更长时间，这是最耗时的操作
-	default:
-		requestTimeout = 40 * time.Second // 其他方法使用默认超时
-	}
-
-	// 构建 JSON-RPC 请求体
-	request := JSONRPCRequest{
-		JSONRPC: "2.0",
-		Method:  method,
-		Params:  params,
-		ID:      1,
-	}
-
-	// 将请求体编码为 JSON
-	requestBody, err := json.Marshal(request)
-	if err != nil {
-		log.Error("Error marshaling JSON request:", err)
-		return nil, err
-	}
-
-	// 使用读写锁保护并发请求
-	rpcMutex.RLock()
-	defer rpcMutex.RUnlock()
-
-	// 记录请求开始
-	log.Debug("Starting RPC request", "method", method, "timeout", requestTimeout, "req", string(requestBody))
-
-	var lastErr error
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// 对于状态根查询，如果重试则增加超时时间
-		currentTimeout := requestTimeout
-		if method == "qng_getStateRoot" && attempt > 0 {
-			currentTimeout = requestTimeout + time.Duration(attempt*30)*time.Second
-			log.Debug("Increased timeout for state root query", "attempt", attempt+1, "newTimeout", currentTimeout)
-		}
-
-		// 创建带超时的上下文，使用动态超时时间
-		ctx, cancel := context.WithTimeout(context.Background(), currentTimeout)
-
-		// 创建HTTP请求
-		req, err := http.NewRequestWithContext(ctx, "POST", rpcurl, bytes.NewBuffer(requestBody))
-		if err != nil {
-			cancel()
-			log.Error("Error creating HTTP request:", err)
-			return nil, err
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		// 发送请求
-		resp, err := httpClient.Do(req)
-		cancel() // 释放上下文资源
-
-		if err != nil {
-			lastErr = err
-			// 检查是否是超时错误
-			if ctx.Err() == context.DeadlineExceeded {
-				log.Warn("RPC request timeout", "method", method, "timeout", requestTimeout, "attempt", attempt+1, "of", maxRetries)
-			} else {
-				log.Warn("HTTP request failed", "method", method, "attempt", attempt+1, "of", maxRetries, "error", err)
-			}
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay * time.Duration(attempt+1)) // 指数退避
-				continue
-			}
-			return nil, err
-		}
-
-		// 读取响应
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		if err != nil {
-			lastErr = err
-			log.Warn("Error reading response body, attempt", attempt+1, "of", maxRetries, "error:", err)
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay * time.Duration(attempt+1))
-				continue
-			}
-			return nil, err
-		}
-
-		// 检查HTTP状态码
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("HTTP error: %d", resp.StatusCode)
-			log.Warn("HTTP error status", resp.StatusCode, "attempt", attempt+1, "of", maxRetries)
-			if attempt < maxRetries-1 {
-				time.Sleep(retryDelay * time.Duration(attempt+1))
-				continue
-			}
-			return nil, lastErr
-		}
-
-		// 成功返回
-		log.Debug("RPC request successful", "method", method, "attempt", attempt+1)
-		return body, nil
-	}
-
-	return nil, fmt.Errorf("RPC request failed after %d attempts, last error: %v", maxRetries, lastErr)
-}
-
 // authKey is a custom context key for storing the auth token.
 type authKey struct{}
 
@@ -218,120 +99,337 @@ func authFromEnv(ctx context.Context) context.Context {
 	return withAuthKey(ctx, os.Getenv("API_KEY"))
 }
 
+// builtinTool is a hand-written tool and the toolset it belongs to.
+type builtinTool struct {
+	category string
+	tool     server.ServerTool
+}
+
 type MCPServer struct {
 	server *server.MCPServer
+	// rpc is the client of the node the tools query.
+	rpc *Client
+
+	// toolsMu guards the toolset managed tools below.
+	toolsMu sync.Mutex
+	builtin []builtinTool
+	// toolsets holds the toolsets enabled for every session; nil enables
+	// all of them.
+	toolsets map[string]bool
+	// sessionToolsets holds the toolsets each session enabled on top of
+	// toolsets with qng_enable_toolset, by session ID.
+	sessionToolsets map[string]*sessionToolset
+	// categories maps the name of every toolset managed tool to its
+	// toolset.
+	categories map[string]string
+	// registered lists the names of the tools registerTools added.
+	registered []string
+
+	// events keeps the node events of the subscriptions.
+	events eventLog
+
+	// urlPolicy decides which nodes the rpc_url argument may point at.
+	urlPolicy RPCURLPolicy
+	// guarded connects to allowlisted rpc_url nodes, refusing private
+	// addresses.
+	guarded *http.Client
+	// networks are the named networks the network argument selects; the
+	// first is the default network, whose client is rpc.
+	networks []*Network
 }
 
-func handleQngWeb3Rpc(
+func (s *MCPServer) handleQngWeb3Rpc(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
-	pn, ok := request.Params.Arguments["parameterNum"]
-	if !ok {
-		pn = 0
-	}
-	// return nil, fmt.Errorf("missing or invalid " + fmt.Sprintf("parameter%d", 1))
-	name := strings.ReplaceAll(request.Params.Name, "qngserver__", "")
+	// catalog tools are registered under their call name, see registerTools
 	methods, err := GetMethods()
 	if err != nil {
 		return nil, err
 	}
-	method, err := methods.FindName(name)
+	method, err := methods.FindName(request.Params.Name)
 	if err != nil {
 		return nil, err
 	}
-	count, ok := pn.(int)
-	if !ok {
-		count, _ = strconv.Atoi(pn.(string))
+	params, err := buildParams(method, request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult(method.Name, err)
 	}
-	if method.Params != count {
-		if method.Params < count {
-			count = method.Params
-		} else {
-			return nil, fmt.Errorf("missing or invalid " + fmt.Sprintf("parameter%d", method.Params))
-		}
+	rpc, err := s.networkArg(request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult(method.Name, err)
 	}
-	params := make([]interface{}, 0)
-	for i := 0; i < count; i++ {
-		p, ok := request.Params.Arguments[fmt.Sprintf("parameter%d", i)]
-		if !ok {
-			return nil, fmt.Errorf("missing or invalid " + fmt.Sprintf("parameter%d", i))
+	log.Debug("handleQngWeb3Rpc", "method", method.Name, "params", params)
+	body, err := rpc.CallRaw(ctx, method.Name, params)
+	if err != nil {
+		log.Debug("handleQngWeb3Rpc", "method", method.Name, "error", err)
+		return toolErrorResult(method.Name, err)
+	}
+	log.Debug("handleQngWeb3Rpc", "result", string(body))
+	return rpcToolResult(method.Name, body), nil
+}
+
+// buildParams maps the named tool arguments onto the positional params of
+// method. Missing optional params take their default, or null when there is
+// none; trailing nulls are dropped so the node applies its own defaults.
+// Rejected arguments are reported as *ToolError.
+func buildParams(method Method, args map[string]interface{}) ([]interface{}, error) {
+	if method.Generic {
+		switch v := args["params"].(type) {
+		case nil:
+			return []interface{}{}, nil
+		case []interface{}:
+			return v, nil
+		default:
+			return nil, invalidArgument("params", "invalid argument params: expected a JSON array, got %T", v)
 		}
-		// Optimize parameter type handling using type switch
-		switch v := p.(type) {
-		case string:
-			if v == "true" {
-				params = append(params, true)
-			} else if v == "false" {
-				params = append(params, false)
-			} else if num, err := strconv.Atoi(v); err == nil {
-				params = append(params, num)
-			} else if fnum, err := strconv.ParseFloat(v, 64); err == nil {
-				params = append(params, fnum)
-			} else {
-				params = append(params, v)
+	}
+	params := make([]interface{}, 0, len(method.Params))
+	for _, p := range method.Params {
+		v, ok := args[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				return nil, invalidArgument(p.Name, "missing required argument %s", p.Name)
 			}
-		default:
-			params = append(params, v)
+			params = append(params, p.Default)
+			continue
+		}
+		cv, err := coerceParam(p, v)
+		if err != nil {
+			return nil, invalidArgument(p.Name, "%v", err)
 		}
+		params = append(params, cv)
 	}
-	log.Debug("handleQngWeb3Rpc", "method", method.Name, "params", params)
-	body, err := JsonRpcResponse(rpcUrl, method.Name, params)
-	if err != nil {
-		return nil, err
+	for len(params) > 0 && params[len(params)-1] == nil {
+		params = params[:len(params)-1]
 	}
-	log.Debug("handleQngWeb3Rpc", "result", string(body))
-	return mcp.NewToolResultText(string(body)), nil
+	return params, nil
 }
-func NewMCPServer() *MCPServer {
+
+// NewMCPServer returns a server whose tools query the node through rpc.
+func NewMCPServer(rpc *Client) *MCPServer {
+	s := &MCPServer{
+		rpc:             rpc,
+		sessionToolsets: make(map[string]*sessionToolset),
+		urlPolicy:       rpcURLPolicy,
+		guarded:         guardedHTTPClient(),
+		networks:        configuredNetworks,
+	}
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(s.onUnregisterSession)
+	inflight := newInflightCalls()
 	mcpServer := server.NewMCPServer(
 		"qng-mcp-server",
 		"1.0.0",
 		server.WithResourceCapabilities(true, true),
 		server.WithPromptCapabilities(true),
 		server.WithToolCapabilities(true),
+		server.WithToolFilter(s.filterTools),
+		server.WithHooks(hooks),
+		inflight.register(hooks),
 	)
+	mcpServer.AddNotificationHandler(methodNotificationCancelled, inflight.handleCancelled)
+	s.server = mcpServer
 
 	// Core QNG blockchain tools with enhanced descriptions for better AI model understanding
 
-	mcpServer.AddTool(mcp.NewTool("qng_get_block_by_order",
+	if enabledToolsets != nil {
+		s.toolsets = make(map[string]bool, len(enabledToolsets))
+		for k, v := range enabledToolsets {
+			s.toolsets[k] = v
+		}
+	}
+
+	s.addBuiltinTool(CategoryBlock, mcp.NewTool("qng_get_block_by_order",
 		mcp.WithDescription("QNG BLOCK RETRIEVAL: Fetches complete block information by block order/height. Returns block header, transactions, timestamps, hash, and all blockchain metadata. Use this tool when you need detailed information about a specific block in the QNG blockchain."),
 		mcp.WithString("rpc_url",
-			mcp.Description("QNG RPC endpoint URL (required). Format: http://ip:port/ or https://ip:port/. Example: http://127.0.0.1:8545/"),
-			mcp.Required(),
+			mcp.Description(rpcURLDescription),
 		),
 		mcp.WithNumber("block_order",
 			mcp.Description("Block order/height number (required). Non-negative integer representing block position in chain. Example: 1000 for block 1000"),
 			mcp.Required(),
 		),
-	), handleGetBlockByOrderTool)
+	), s.handleGetBlockByOrderTool)
 
-	mcpServer.AddTool(mcp.NewTool("qng_get_block_count",
+	s.addBuiltinTool(CategoryBlock, mcp.NewTool("qng_get_blocks_and_txs",
+		mcp.WithDescription(fmt.Sprintf("QNG BATCH RETRIEVAL: Fetches many blocks by order and many transactions by hash in a single round trip to the node. Returns one item per requested block or transaction, in request order; an item that failed carries its own error while the others still return data. Use this instead of repeated single block or transaction calls. At most %d items per call.", maxBatchSize)),
+		mcp.WithArray("block_orders",
+			mcp.Description("Block orders to fetch. Example: [1000, 1001, 1002]"),
+			mcp.Items(map[string]interface{}{"type": ParamInteger, "minimum": 0}),
+		),
+		mcp.WithArray("tx_hashes",
+			mcp.Description("Transaction hashes to fetch (64 hex characters each)."),
+			mcp.Items(map[string]interface{}{"type": ParamString, "pattern": hashPattern}),
+		),
+		mcp.WithBoolean("verbose",
+			mcp.Description("Return decoded JSON objects instead of serialized hex."),
+			mcp.DefaultBool(true),
+		),
+	), s.handleGetBlocksAndTxs)
+
+	s.addBuiltinTool(CategoryChain, mcp.NewTool("qng_get_block_count",
 		mcp.WithString("rpc_url",
-			mcp.Description("QNG RPC endpoint URL (required). Format: http://ip:port/ or https://ip:port/. Example: http://127.0.0.1:8545/"),
-			mcp.Required(),
+			mcp.Description(rpcURLDescription),
 		),
 		mcp.WithDescription("QNG BLOCKCHAIN HEIGHT: Returns the total number of blocks in the QNG blockchain. This gives you the current blockchain height/length. Use this tool to check how many blocks have been mined since genesis, or to get the latest block number."),
-	), handleGetBlockCount)
+	), s.handleGetBlockCount)
 
-	mcpServer.AddTool(mcp.NewTool("qng_get_stateroot",
+	s.addBuiltinTool(CategoryBlock, mcp.NewTool("qng_get_stateroot",
 		mcp.WithDescription("QNG STATE ROOT: Retrieves the stateroot hash of a specific QNG block. The state root is a cryptographic hash representing the complete blockchain state at that block (all account balances, smart contract states, etc.). Use this tool for state verification and blockchain analysis."),
 		mcp.WithNumber("block_order",
 			mcp.Description("Block order/height number (required). Non-negative integer representing block position in chain. Example: 1000 for block 1000"),
 			mcp.Required(),
 		),
 		mcp.WithString("rpc_url",
-			mcp.Description("QNG RPC endpoint URL (required). Format: http://ip:port/ or https://ip:port/. Example: http://127.0.0.1:8545/"),
-			mcp.Required(),
+			mcp.Description(rpcURLDescription),
 		),
-	), handleGetStateRoot)
+	), s.handleGetStateRoot)
+
+	if discoverMethods {
+		mcpServer.AddTool(mcp.NewTool("qng_discovery_report",
+			mcp.WithDescription("QNG DISCOVERY DIAGNOSTICS: Shows which catalog methods the connected QNG node serves, which were hidden because the node lacks them, and which uncatalogued node methods were exposed with a generic schema. Use this tool when a QNG tool you expect is missing."),
+		), handleDiscoveryReport)
+	}
+
+	mcpServer.AddTool(mcp.NewTool("qng_endpoint_status",
+		mcp.WithDescription("QNG ENDPOINT STATUS: Lists the QNG node endpoints this server uses with their priority, health, sync state, block count, lag behind the best endpoint, circuit breaker state, concurrency and request counts. Use this tool to see which node answered or why a node was skipped."),
+	), s.handleEndpointStatus)
+	mcpServer.AddResource(mcp.NewResource("qng://endpoints", "QNG node endpoints",
+		mcp.WithResourceDescription("Health and usage of the configured QNG node endpoints."),
+		mcp.WithMIMEType("application/json"),
+	), s.handleEndpointsResource)
+	if len(s.networks) > 0 {
+		mcpServer.AddTool(mcp.NewTool("qng_list_networks",
+			mcp.WithDescription("QNG NETWORKS: Lists the QNG networks this server can query (such as mainnet and testnet) with their display names, chain parameters and endpoints. Pass a network name as the network argument of other QNG tools instead of guessing RPC URLs."),
+		), s.handleListNetworks)
+		mcpServer.AddResource(mcp.NewResource("qng://networks", "QNG networks",
+			mcp.WithResourceDescription("The configured QNG networks with their chain parameters and endpoints."),
+			mcp.WithMIMEType("application/json"),
+		), s.handleNetworksResource)
+	}
+	if rpc.cache != nil {
+		mcpServer.AddResource(mcp.NewResource("qng://cache", "QNG response cache",
+			mcp.WithResourceDescription("Size and hit rate of the cache of immutable chain data, such as blocks and state roots deep below the tip."),
+			mcp.WithMIMEType("application/json"),
+		), s.handleCacheResource)
+	}
+	mcpServer.AddResource(mcp.NewResource("qng://metrics", "QNG MCP server metrics",
+		mcp.WithResourceDescription("Counters of the server, such as circuit breaker transitions and rejected requests, in the Prometheus text format."),
+		mcp.WithMIMEType("text/plain"),
+	), s.handleMetricsResource)
+
+	if s.toolsets != nil {
+		mcpServer.AddTool(mcp.NewTool("qng_enable_toolset",
+			mcp.WithDescription("QNG TOOLSETS: Only some groups of QNG tools are enabled to keep the tool list short. Call this tool to enable another group; its tools become available right away. Groups: "+strings.Join(Categories, ", ")+"."),
+			mcp.WithString("toolset",
+				mcp.Description("Name of the toolset to enable, or \"all\" to enable every toolset."),
+				mcp.Enum(append(append([]string{}, Categories...), toolsetAll)...),
+				mcp.Required(),
+			),
+		), s.handleEnableToolset)
+	}
+
+	s.registerTools()
+	return s
+}
+
+// addBuiltinTool records a hand-written tool of the given toolset. It is
+// registered by registerTools while its toolset is enabled.
+func (s *MCPServer) addBuiltinTool(category string, tool mcp.Tool, handler server.ToolHandlerFunc) {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	s.builtin = append(s.builtin, builtinTool{
+		category: category,
+		tool:     server.ServerTool{Tool: tool, Handler: handler},
+	})
+}
+
+// toolsetEnabled reports whether tools of category are enabled for every
+// session. It must be called with toolsMu held.
+func (s *MCPServer) toolsetEnabled(category string) bool {
+	return s.toolsets == nil || s.toolsets[category]
+}
 
-	return &MCPServer{
-		server: mcpServer,
+// toolsFor returns the built-in tools and the tools of the active catalog,
+// the latter handled by handleQngWeb3Rpc, whose category is accepted by
+// enabled. It must be called with toolsMu held.
+func (s *MCPServer) toolsFor(enabled func(category string) bool) []server.ServerTool {
+	serverTools := make([]server.ServerTool, 0, len(s.builtin))
+	for _, b := range s.builtin {
+		if enabled(b.category) {
+			serverTools = append(serverTools, server.ServerTool{Tool: s.withNetworkArg(b.tool.Tool), Handler: b.tool.Handler})
+		}
+	}
+	for _, t := range parseAndGenerateGoCode(enabled) {
+		serverTools = append(serverTools, server.ServerTool{Tool: s.withNetworkArg(t), Handler: s.handleQngWeb3Rpc})
+	}
+	return serverTools
+}
+
+// registerTools registers the tools of the toolsets enabled for every
+// session, and those enabled by sessions that share the server's tools (see
+// sessionToolset), the latter guarded by gateTool. Tools registered by a
+// previous call that are no longer wanted are removed, so calling it again
+// after a catalog reload or a toolset change keeps the server in sync.
+func (s *MCPServer) registerTools() {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+
+	s.categories = make(map[string]string)
+	for _, b := range s.builtin {
+		s.categories[b.tool.Tool.Name] = b.category
+	}
+	if methods, err := GetMethods(); err == nil {
+		for _, m := range methods {
+			if !m.Internal {
+				s.categories[m.Call] = m.Category
+			}
+		}
 	}
+	serverTools := s.toolsFor(s.sharedEnabled)
+	for i, t := range serverTools {
+		if category := s.categories[t.Tool.Name]; !s.toolsetEnabled(category) {
+			serverTools[i].Handler = s.gateTool(t.Tool.Name, category, t.Handler)
+		}
+	}
+	s.refreshSessionTools()
+
+	names := make([]string, 0, len(serverTools))
+	current := make(map[string]struct{}, len(serverTools))
+	for _, t := range serverTools {
+		names = append(names, t.Tool.Name)
+		current[t.Tool.Name] = struct{}{}
+	}
+	var stale []string
+	for _, name := range s.registered {
+		if _, ok := current[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		s.server.DeleteTools(stale...)
+	}
+	s.server.AddTools(serverTools...)
+	s.registered = names
+	log.Debug("Registered tools", "count", len(names), "removed", len(stale))
 }
 
-func parseAndGenerateGoCode() []mcp.Tool {
+// onMethodsChanged re-registers the tools after the method catalog
+// was reloaded. Registration notifies connected clients with
+// tools/list_changed so they fetch the tool list again.
+func (s *MCPServer) onMethodsChanged(m QngMethods) {
+	if discoverMethods {
+		merged, _ := Discover(context.Background(), s.rpc, m)
+		if err := SetMethods(merged); err != nil {
+			log.Warn("Ignoring discovery result", "error", err)
+		}
+	}
+	s.registerTools()
+}
+
+// parseAndGenerateGoCode builds a tool for every catalog method whose
+// category is accepted by enabled.
+func parseAndGenerateGoCode(enabled func(category string) bool) []mcp.Tool {
 	ret := []mcp.Tool{}
 	methods, err := GetMethods()
 	if err != nil {
@@ -339,17 +437,18 @@ func parseAndGenerateGoCode() []mcp.Tool {
 		return nil
 	}
 	for _, m := range methods {
+		if m.Internal || !enabled(m.Category) {
+			continue
+		}
 		toolOpt := make([]mcp.ToolOption, 0)
 		toolOpt = append(toolOpt, mcp.WithDescription(m.Desc))
-		toolOpt = append(toolOpt, mcp.WithNumber("parameterNum",
-			mcp.Title("Parameter Count"),
-			mcp.Description("The total number of parameters required for this QNG RPC method call. This must match the expected parameter count for the specific method being called."), mcp.Required()))
-		for i := 0; i < m.Params; i++ {
-			toolOpt = append(toolOpt,
-				mcp.WithString(fmt.Sprintf("parameter%d", i),
-					mcp.Title(fmt.Sprintf("Parameter %d", i+1)),
-					mcp.Description(fmt.Sprintf("The %dth parameter for the %s method call. Refer to QNG RPC documentation for specific parameter requirements and data types.", i+1, m.Name)),
-					mcp.Required()))
+		if m.Generic {
+			// any JSON values, not just the strings paramOption allows
+			toolOpt = append(toolOpt, mcp.WithArray("params", mcp.Description(m.Params[0].Desc)))
+		} else {
+			for _, p := range m.Params {
+				toolOpt = append(toolOpt, paramOption(p))
+			}
 		}
 		ret = append(ret, mcp.NewTool(
 			m.Call,
@@ -360,6 +459,62 @@ func parseAndGenerateGoCode() []mcp.Tool {
 	return ret
 }
 
+// paramOption builds the input schema property for a catalog param.
+func paramOption(p Param) mcp.ToolOption {
+	opts := []mcp.PropertyOption{mcp.Description(p.Desc)}
+	if p.Required {
+		opts = append(opts, mcp.Required())
+	}
+	if len(p.Enum) > 0 {
+		opts = append(opts, mcp.Enum(p.Enum...))
+	}
+	if p.Format == FormatHash {
+		opts = append(opts, mcp.Pattern(hashPattern))
+	}
+	switch p.Type {
+	case ParamNumber, ParamInteger:
+		if d, ok := toFloat64(p.Default); ok {
+			opts = append(opts, mcp.DefaultNumber(d))
+		}
+		if p.Type == ParamInteger {
+			// mcp-go has no WithInteger, so narrow the number schema
+			opts = append(opts, func(schema map[string]interface{}) { schema["type"] = ParamInteger })
+		}
+		return mcp.WithNumber(p.Name, opts...)
+	case ParamBoolean:
+		if d, ok := p.Default.(bool); ok {
+			opts = append(opts, mcp.DefaultBool(d))
+		}
+		return mcp.WithBoolean(p.Name, opts...)
+	case ParamArray:
+		if d, ok := p.Default.([]interface{}); ok {
+			opts = append(opts, mcp.DefaultArray(d))
+		}
+		opts = append(opts, mcp.Items(map[string]interface{}{"type": ParamString}))
+		return mcp.WithArray(p.Name, opts...)
+	default:
+		if d, ok := p.Default.(string); ok {
+			opts = append(opts, mcp.DefaultString(d))
+		}
+		return mcp.WithString(p.Name, opts...)
+	}
+}
+
+// toFloat64 converts a numeric default decoded from JSON or YAML.
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
 func (s *MCPServer) ServeSSE(addr string) *server.SSEServer {
 	return server.NewSSEServer(s.server,
 		server.WithBaseURL(fmt.Sprintf("http://%s", addr)),
@@ -372,91 +527,185 @@ func (s *MCPServer) ServeStdio() error {
 }
 
 // handleGetBlockByOrderTool handles the qng_get_block_by_order tool request.
-func handleGetBlockByOrderTool(
+func (s *MCPServer) handleGetBlockByOrderTool(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
-	order, ok := request.Params.Arguments["block_order"]
-	if !ok {
-		return nil, fmt.Errorf("missing or invalid block_order parameter")
+	order, err := blockOrderArg(request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult("qng_getBlockByOrder", err)
+	}
+	rpc, err := s.clientArg(request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult("qng_getBlockByOrder", err)
 	}
-	rpc, ok := request.Params.Arguments["rpc_url"]
+	// the node's result is passed on as is, see Client.GetBlockByOrder for
+	// a decoded block
+	body, err := rpc.CallRaw(ctx, "qng_getBlockByOrder", blockByOrderParams(order))
+	if err != nil {
+		log.Debug("handleGetBlockByOrderTool", "error", err)
+		return toolErrorResult("qng_getBlockByOrder", err)
+	}
+	return rpcToolResult("qng_getBlockByOrder", body), nil
+}
+
+// blockOrderArg reads the block_order argument of the built-in tools.
+func blockOrderArg(args map[string]interface{}) (uint64, error) {
+	order, ok := args["block_order"]
+	if !ok || order == nil {
+		return 0, invalidArgument("block_order", "missing required argument block_order")
+	}
+	n, err := toUint64(order)
+	if err != nil {
+		return 0, invalidArgument("block_order", "invalid argument block_order: %v", err)
+	}
+	return n, nil
+}
+
+// clientArg returns the client for the optional network and rpc_url
+// arguments of the built-in tools. Without rpc_url the endpoints of the
+// network are used; other nodes must be allowed by the server's
+// RPCURLPolicy, see rpcurl.go.
+func (s *MCPServer) clientArg(args map[string]interface{}) (*Client, error) {
+	rpc, err := s.networkArg(args)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := args["rpc_url"]
+	if !ok || v == nil || v == "" {
+		return rpc, nil
+	}
+	raw, ok := v.(string)
 	if !ok {
-		log.Debug("handleGetBlockByOrderTool", "rpc_url", rpc)
-		return nil, fmt.Errorf("missing or invalid rpc_url parameter")
+		return nil, invalidArgument("rpc_url", "invalid rpc_url argument: expected a string, got %T", v)
+	}
+	if rpc.HasEndpoint(raw) {
+		return rpc, nil
+	}
+	for _, e := range rpc.endpoints {
+		if e.Name == raw {
+			return rpc.WithEndpoint(e.URL), nil
+		}
+	}
+	if target, ok := s.urlPolicy.Aliases[raw]; ok {
+		return rpc.WithEndpoint(target), nil
+	}
+	return s.allowedClient(raw)
+}
+
+// jsonToolResult returns v encoded as JSON text.
+func jsonToolResult(v interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// handleDiscoveryReport handles the qng_discovery_report tool request.
+func handleDiscoveryReport(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	report := LastDiscoveryReport()
+	if report == nil {
+		return mcp.NewToolResultText("Node discovery has not run yet."), nil
 	}
-	body, err := JsonRpcResponse(rpc.(string), "qng_getBlockByOrder", []interface{}{order, true})
+	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
 		return nil, err
 	}
-	log.Debug("handleGetBlockByOrderTool", "result", string(body))
-	return mcp.NewToolResultText(string(body)), nil
+	return mcp.NewToolResultText(string(data)), nil
 }
 
 // handleGetBlockCount handles the qng_get_block_count tool request.
-func handleGetBlockCount(
+func (s *MCPServer) handleGetBlockCount(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
-	rpc, ok := request.Params.Arguments["rpc_url"]
-	if !ok {
-		log.Debug("handleGetBlockCount", "rpc_url", rpc)
-		return nil, fmt.Errorf("missing or invalid rpc_url parameter")
+	rpc, err := s.clientArg(request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult("qng_getBlockCount", err)
 	}
-	body, err := JsonRpcResponse(rpc.(string), "qng_getBlockCount", []interface{}{})
+	body, err := rpc.CallRaw(ctx, "qng_getBlockCount", []interface{}{})
 	if err != nil {
-		return nil, err
+		log.Debug("handleGetBlockCount", "error", err)
+		return toolErrorResult("qng_getBlockCount", err)
 	}
 	log.Debug("handleGetBlockCount", "result", string(body))
-	return mcp.NewToolResultText(string(body)), nil
+	return rpcToolResult("qng_getBlockCount", body), nil
 }
 
 // handleGetStateRoot handles the qng_get_block_stateroot tool request.
-func handleGetStateRoot(
+func (s *MCPServer) handleGetStateRoot(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
-	order, ok := request.Params.Arguments["block_order"]
-	if !ok {
-		log.Debug("handleGetStateRoot", "block_order", order)
-		return nil, fmt.Errorf("missing or invalid block_order parameter")
-	}
-
-	rpc, ok := request.Params.Arguments["rpc_url"]
-	if !ok {
-		log.Debug("handleGetStateRoot", "rpc_url", rpc)
-		return nil, fmt.Errorf("missing or invalid rpc_url parameter")
+	order, err := blockOrderArg(request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult("qng_getStateRoot", err)
 	}
-	log.Debug("handleGetStateRoot", "block_order", order, "rpc_url", rpc)
-	orderNum := int64(0)
-	switch order.(type) {
-	case int64:
-		orderNum = order.(int64)
-	case string:
-		orderNum, _ = strconv.ParseInt(order.(string), 10, 64)
-	case float64:
-		orderNum = int64(order.(float64))
-	default:
-		log.Debug("handleGetStateRoot", "block_order", order)
-		return nil, fmt.Errorf("missing or invalid block_order parameter")
+	rpc, err := s.clientArg(request.Params.Arguments)
+	if err != nil {
+		return toolErrorResult("qng_getStateRoot", err)
 	}
-	body, err := JsonRpcResponse(rpc.(string), "qng_getStateRoot", []interface{}{orderNum, true})
+	log.Debug("handleGetStateRoot", "block_order", order, "rpc_url", rpc.Endpoint())
+	body, err := rpc.CallRaw(ctx, "qng_getStateRoot", stateRootParams(order))
 	if err != nil {
-		log.Debug("JsonRpcResponse", "error", err)
-		return nil, err
+		log.Debug("handleGetStateRoot", "error", err)
+		return toolErrorResult("qng_getStateRoot", err)
 	}
-	log.Debug("handleGetStateRoot", "result", string(body), "rpc_url", rpc)
-	return mcp.NewToolResultText(string(body)), nil
+	return rpcToolResult("qng_getStateRoot", body), nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(runCacheCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fakenode" {
+		os.Exit(runFakenodeCommand(os.Args[2:]))
+	}
 	var transport string
 	var timeoutSeconds int
+	var toolsets string
+	var backoffInitial, backoffMax time.Duration
+	var cacheFile string
+	var cacheMaxBytes int64
+	var recordFile, replayFile string
 	flag.StringVar(&transport, "t", "stdio", "Transport type (stdio or sse)")
-	flag.StringVar(&rpcUrl, "rpc", "http://127.0.0.1:8545/", "qng rpc url")
+	flag.StringVar(&rpcUrl, "rpc", "http://127.0.0.1:8545/", "qng rpc url (http(s)://, ws(s):// or ipc:///path/to/qng.ipc), or a comma separated list of urls in order of preference")
+	applyRPCURLFlags := rpcURLFlags(flag.CommandLine)
+	flag.StringVar(&subscribeTopics, "subscribe", "", "Comma separated node events to push to clients (blocks, mempool), needs a ws:// endpoint")
+	flag.StringVar(&endpointsFile, "endpoints", "", "Node endpoints file (JSON or YAML) with priorities, overrides -rpc")
+	flag.StringVar(&networksFile, "networks", "", "Named networks file (JSON or YAML) with the endpoints of each network, overrides -rpc and -endpoints")
+	flag.StringVar(&defaultNetwork, "network", "", "Network queried by default ("+strings.Join(networkNames(), ", ")+"); nodes must report it")
+	flag.DurationVar(&healthInterval, "health-interval", healthInterval, "How often node endpoints are health checked, 0 disables")
+	flag.Uint64Var(&maxBlockLag, "max-lag", maxBlockLag, "Blocks an endpoint may lag behind the best endpoint before it is skipped")
+	flag.IntVar(&defaultBreakerConfig.Failures, "breaker-failures", defaultBreakerConfig.Failures, "Consecutive failures that open an endpoint's circuit breaker, 0 disables it")
+	flag.DurationVar(&defaultBreakerConfig.Cooldown, "breaker-cooldown", defaultBreakerConfig.Cooldown, "How long an open circuit breaker rejects requests before probing the endpoint")
+	flag.IntVar(&defaultConcurrencyConfig.Max, "max-concurrency", defaultConcurrencyConfig.Max, "Requests in flight per endpoint, 0 for unlimited")
+	flag.IntVar(&defaultConcurrencyConfig.Queue, "max-queue", defaultConcurrencyConfig.Queue, "Requests that may wait for an endpoint before failing fast")
+	flag.Float64Var(&defaultRateLimitConfig.Rate, "rate-limit", 0, "Requests per second sent to each endpoint, 0 for unlimited")
+	flag.IntVar(&defaultRateLimitConfig.Burst, "rate-burst", 10, "Requests that may be sent to an endpoint at once within -rate-limit")
+	flag.Float64Var(&defaultRateLimitConfig.ExpensiveRate, "rate-limit-expensive", 0, "Calls of expensive methods (state roots, address transactions, blocks with full transactions) per second and endpoint, 0 for unlimited")
+	flag.IntVar(&defaultRateLimitConfig.ExpensiveBurst, "rate-burst-expensive", 2, "Expensive calls that may be sent to an endpoint at once within -rate-limit-expensive")
+	flag.BoolVar(&defaultRateLimitConfig.FailFast, "rate-limit-fail-fast", false, "Turn over-limit requests away at once instead of letting them wait until their deadline")
+	flag.IntVar(&defaultCacheConfig.Size, "cache-size", defaultCacheConfig.Size, "Results of immutable chain data kept in memory, 0 disables the cache")
+	flag.Uint64Var(&defaultCacheConfig.FinalDepth, "cache-final-depth", defaultCacheConfig.FinalDepth, "Confirmations after which a cached result never expires")
+	flag.DurationVar(&defaultCacheConfig.TipTTL, "cache-tip-ttl", defaultCacheConfig.TipTTL, "How long cached results closer to the tip are reused")
+	flag.StringVar(&cacheFile, "cache-file", "", "File keeping final cached results across restarts, empty keeps them in memory only")
+	flag.Int64Var(&cacheMaxBytes, "cache-max-bytes", 256<<20, "Size cap of the cache file, the least recently used results are evicted first; 0 for unlimited")
+	flag.StringVar(&recordFile, "record", "", "Record every JSON-RPC request and response sent to the node to this cassette file")
+	flag.StringVar(&replayFile, "replay", "", "Answer JSON-RPC requests from this cassette file instead of a node")
 	flag.StringVar(&logLevel, "loglevel", "info", "Log level (debug, info, warn, error)")
 	flag.StringVar(&currentMcpServer, "mcp", "localhost:8080", "mcp server url")
-	flag.IntVar(&timeoutSeconds, "timeout", 60, "RPC request timeout in seconds (default: 60)")
+	flag.IntVar(&timeoutSeconds, "timeout", 40, "Default RPC request timeout in seconds, per attempt")
+	flag.IntVar(&defaultRetryPolicy.MaxAttempts, "retries", defaultRetryPolicy.MaxAttempts, "Default number of attempts per RPC request")
+	flag.DurationVar(&backoffInitial, "retry-backoff", time.Duration(defaultRetryPolicy.Backoff.Initial), "Default delay before the first retry")
+	flag.DurationVar(&backoffMax, "retry-backoff-max", time.Duration(defaultRetryPolicy.Backoff.Max), "Default upper bound of the retry delay")
+	flag.StringVar(&methodsFile, "methods", "", "Method catalog file (JSON or YAML), reloaded on change")
+	flag.StringVar(&toolsets, "toolsets", toolsetAll, "Comma separated toolsets to register ("+strings.Join(Categories, ",")+" or all)")
+	flag.BoolVar(&discoverMethods, "discover", false, "Probe the node at startup and expose only the methods it serves")
 	flag.StringVar(
 		&transport,
 		"transport",
@@ -465,9 +714,13 @@ func main() {
 	)
 	flag.Parse()
 
-	// 设置RPC超时
-	rpcTimeout = time.Duration(timeoutSeconds) * time.Second
-	httpClient.Timeout = rpcTimeout
+	// 设置RPC默认超时和重试策略
+	defaultRetryPolicy.Timeout = time.Duration(timeoutSeconds) * time.Second
+	defaultRetryPolicy.Backoff.Initial = Duration(backoffInitial)
+	defaultRetryPolicy.Backoff.Max = Duration(backoffMax)
+	if defaultRetryPolicy.MaxAttempts < 1 {
+		defaultRetryPolicy.MaxAttempts = 1
+	}
 	// 设置日志等级为 DEBUG
 	lvl, err := log.LvlFromString(logLevel)
 	if err != nil {
@@ -478,24 +731,203 @@ func main() {
 	// Print usage instructions
 	log.Info("\nUsage:")
 	log.Info("  -t, --transport  Transport type (stdio or sse)")
-	log.Info("  --rpc            QNG Web3 RPC URL")
+	log.Info("  --rpc            QNG Web3 RPC URL, or a comma separated list for failover")
+	log.Info("  --rpc-allow      Nodes the rpc_url tool argument may use besides the configured ones (URLs, hosts, name=url)")
+	log.Info("  --rpc-allow-private Let rpc_url reach allowed nodes on private addresses")
+	log.Info("  --endpoints      Node endpoints file (JSON or YAML) with priorities")
+	log.Info("  --networks       Named networks file (JSON or YAML), tools take a network argument")
+	log.Info("  --network        Network queried by default; nodes must report it in qng_getNodeInfo")
+	log.Info("  --subscribe      Node events to push to clients (blocks, mempool), needs a ws:// endpoint")
+	log.Info("  --health-interval How often node endpoints are health checked (default: 15s)")
+	log.Info("  --max-lag        Blocks an endpoint may lag behind the best one (default: 10)")
+	log.Info("  --breaker-failures Consecutive failures that open an endpoint's circuit breaker (default: 5)")
+	log.Info("  --breaker-cooldown How long an open circuit breaker rejects requests (default: 30s)")
+	log.Info("  --max-concurrency Requests in flight per endpoint (default: 16)")
+	log.Info("  --max-queue      Requests that may wait for an endpoint before failing fast (default: 64)")
+	log.Info("  --rate-limit     Requests per second sent to each endpoint, 0 for unlimited (default: 0)")
+	log.Info("  --rate-burst     Requests sent to an endpoint at once within the rate limit (default: 10)")
+	log.Info("  --rate-limit-expensive Expensive calls per second and endpoint, 0 for unlimited (default: 0)")
+	log.Info("  --rate-burst-expensive Expensive calls sent to an endpoint at once (default: 2)")
+	log.Info("  --rate-limit-fail-fast Turn over-limit requests away instead of queueing them")
+	log.Info("  --cache-size     Results of immutable chain data kept in memory, 0 disables (default: 1024)")
+	log.Info("  --cache-final-depth Confirmations after which a cached result never expires (default: 10)")
+	log.Info("  --cache-tip-ttl  How long cached results closer to the tip are reused (default: 5s)")
+	log.Info("  --cache-file     File keeping final cached results across restarts (see: qng-mcp cache stats|purge)")
+	log.Info("  --cache-max-bytes Size cap of the cache file (default: 256MiB)")
+	log.Info("  --record         Record the JSON-RPC traffic with the node to a cassette file")
+	log.Info("  --replay         Serve JSON-RPC responses from a cassette file, without a node")
 	log.Info("  --loglevel       Log level (debug, info, warn, error)")
-	log.Info("  --timeout        RPC request timeout in seconds (default: 60)")
+	log.Info("  --timeout        Default RPC request timeout in seconds, per attempt (default: 40)")
+	log.Info("  --retries        Default number of attempts per RPC request (default: 2)")
+	log.Info("  --retry-backoff  Default delay before the first retry (default: 1s)")
+	log.Info("  --retry-backoff-max Default upper bound of the retry delay (default: 10s)")
+	log.Info("  --methods        Method catalog file (JSON or YAML), reloaded on change")
+	log.Info("  --toolsets       Comma separated toolsets to register (default: all)")
+	log.Info("  --discover       Probe the node at startup and expose only the methods it serves")
 	log.Info("\nExample:")
 	log.Info("  ./qng-mcp -t stdio --rpc http://127.0.0.1:8545/ --loglevel debug --mcp localhost:8080 --timeout 90")
 
 	// Print system status
 	log.Info("Starting QNG MCP Server...", "logLevel", logLevel)
 	log.Debug("Transport type", "Transport type", transport)
-	log.Debug("QNG Node Web3 RPC URL", "QNG Node Web3 RPC URL", rpcUrl)
 
 	// Check configuration
-	if rpcUrl == "" {
+	if rpcUrl == "" && endpointsFile == "" && networksFile == "" {
 		log.Error("Error: RPC URL is not configured. Please provide a valid RPC URL using the -rpc flag.")
 		os.Exit(1)
 	}
+	var endpoints []EndpointConfig
+	var networks []NetworkConfig
+	switch {
+	case networksFile != "":
+		networks, err = LoadNetworksFile(networksFile)
+	case endpointsFile != "":
+		endpoints, err = LoadEndpointsFile(endpointsFile)
+	default:
+		endpoints, err = ParseEndpointList(rpcUrl)
+	}
+	if err != nil {
+		log.Error("Error: invalid node endpoints", "error", err)
+		os.Exit(1)
+	}
+	if _, _, ok := chainParams(defaultNetwork); defaultNetwork != "" && !ok {
+		log.Error("Error: invalid --network", "network", defaultNetwork, "expected", strings.Join(networkNames(), ", "))
+		os.Exit(1)
+	}
+	for i := range endpoints {
+		if endpoints[i].Network == "" {
+			endpoints[i].Network = defaultNetwork
+		}
+	}
+
+	if err := applyRPCURLFlags(); err != nil {
+		log.Error("Error: invalid --rpc-allow", "error", err)
+		os.Exit(1)
+	}
+
+	topics, err := ParseTopics(subscribeTopics)
+	if err != nil {
+		log.Error("Error: invalid --subscribe", "error", err)
+		os.Exit(1)
+	}
+
+	if err := defaultRateLimitConfig.validate(); err != nil {
+		log.Error("Error: invalid --rate-limit", "error", err)
+		os.Exit(1)
+	}
 
-	s := NewMCPServer()
+	enabledToolsets, err = ParseToolsets(toolsets)
+	if err != nil {
+		log.Error("Error: invalid --toolsets", "error", err)
+		os.Exit(1)
+	}
+
+	if methodsFile != "" {
+		m, err := LoadMethodsFile(methodsFile)
+		if err == nil {
+			err = SetMethods(m)
+		}
+		if err != nil {
+			log.Error("Error: cannot load method catalog", "path", methodsFile, "error", err)
+			os.Exit(1)
+		}
+		log.Info("Loaded method catalog", "path", methodsFile, "methods", len(m))
+	}
+
+	if cacheFile != "" && defaultCacheConfig.Size > 0 {
+		defaultCacheConfig.Disk, err = OpenDiskCache(cacheFile, cacheMaxBytes)
+		if err != nil {
+			log.Error("Error: cannot open --cache-file", "error", err)
+			os.Exit(1)
+		}
+		stats := defaultCacheConfig.Disk.Stats()
+		log.Info("Opened cache file", "path", cacheFile, "entries", stats.Entries, "bytes", stats.Bytes)
+	}
+
+	opts := []ClientOption{WithCache(defaultCacheConfig)}
+	var cassette *Cassette
+	switch {
+	case recordFile != "" && replayFile != "":
+		log.Error("Error: --record and --replay cannot be used together")
+		os.Exit(1)
+	case recordFile != "":
+		cassette, err = RecordCassette(recordFile)
+		log.Info("Recording node traffic", "cassette", recordFile)
+	case replayFile != "":
+		if len(topics) > 0 {
+			log.Error("Error: --subscribe needs a node and cannot be used with --replay")
+			os.Exit(1)
+		}
+		cassette, err = ReplayCassette(replayFile)
+		log.Info("Replaying node traffic, the node is not contacted", "cassette", replayFile)
+	}
+	if err != nil {
+		log.Error("Error: cannot open cassette", "error", err)
+		os.Exit(1)
+	}
+	if cassette != nil {
+		opts = append(opts, WithCassette(cassette))
+	}
+
+	var rpc *Client
+	var clients []*Client
+	if len(networks) > 0 {
+		configuredNetworks, err = NewNetworks(networks, defaultNetwork, opts...)
+		if err != nil {
+			log.Error("Error: invalid --network", "error", err)
+			os.Exit(1)
+		}
+		rpc = configuredNetworks[0].rpc
+		for _, n := range configuredNetworks {
+			clients = append(clients, n.rpc)
+		}
+	} else {
+		rpc = NewFailoverClient(endpoints, opts...)
+		clients = []*Client{rpc}
+	}
+	replaying := cassette != nil && cassette.Replaying()
+	for _, c := range clients {
+		// a replayed node has fixed answers and is not checked
+		if !replaying {
+			if err := c.VerifyNetwork(context.Background()); err != nil {
+				log.Error("Error: node endpoint serves another network", "error", err)
+				os.Exit(1)
+			}
+			if healthInterval > 0 {
+				go c.RunHealthChecks(context.Background(), healthInterval, maxBlockLag)
+			}
+		}
+		for _, e := range c.Endpoints() {
+			log.Info("Node endpoint", "name", e.Name, "url", e.URL, "priority", e.Priority, "network", e.Network)
+		}
+	}
+
+	if discoverMethods {
+		catalog, err := GetMethods()
+		if err == nil {
+			merged, _ := Discover(context.Background(), rpc, catalog)
+			err = SetMethods(merged)
+		}
+		if err != nil {
+			log.Error("Error: node discovery failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	s := NewMCPServer(rpc)
+	if len(topics) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), wsDialTimeout)
+		err := s.SubscribeNode(ctx, topics)
+		cancel()
+		if err != nil {
+			log.Error("Error: cannot subscribe to node events", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if methodsFile != "" {
+		go WatchMethodsFile(context.Background(), methodsFile, methodsPollInterval, s.onMethodsChanged)
+	}
 
 	switch transport {
 	case "stdio":
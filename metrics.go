@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Metrics counts events of the server. A counter is named like a Prometheus
+// series, with its labels inlined: breaker_transitions_total{endpoint="a",to="open"}.
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[string]uint64
+}
+
+// metrics collects the counters of the running server.
+var metrics = NewMetrics()
+
+// NewMetrics returns an empty set of counters.
+func NewMetrics() *Metrics {
+	return &Metrics{counters: make(map[string]uint64)}
+}
+
+// metricKey names the series of name with the given label key/value pairs,
+// in the order passed.
+func metricKey(name string, labels ...string) string {
+	if len(labels) < 2 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labels[i+1])
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Add adds delta to the counter name with labels.
+func (m *Metrics) Add(name string, delta uint64, labels ...string) {
+	key := metricKey(name, labels...)
+	m.mu.Lock()
+	m.counters[key] += delta
+	m.mu.Unlock()
+}
+
+// Inc increments the counter name with labels.
+func (m *Metrics) Inc(name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+// Get returns the counter name with labels.
+func (m *Metrics) Get(name string, labels ...string) uint64 {
+	key := metricKey(name, labels...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[key]
+}
+
+// Snapshot returns a copy of all counters.
+func (m *Metrics) Snapshot() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]uint64, len(m.counters))
+	for k, v := range m.counters {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// String formats the counters one per line in the Prometheus text format.
+func (m *Metrics) String() string {
+	snapshot := m.Snapshot()
+	keys := make([]string, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatUint(snapshot[k], 10))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// handleMetricsResource serves the qng://metrics resource.
+func (s *MCPServer) handleMetricsResource(
+	ctx context.Context,
+	request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "text/plain",
+		Text:     metrics.String(),
+	}}, nil
+}
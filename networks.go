@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Qitmeer/qng/log"
+	qparams "github.com/Qitmeer/qng/params"
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// NetworkConfig is a named QNG network and the endpoints serving it.
+type NetworkConfig struct {
+	// Name is one of the networks of github.com/Qitmeer/qng/params:
+	// mainnet, testnet, mixnet or privnet.
+	Name        string `json:"name" yaml:"name"`
+	DisplayName string `json:"display_name,omitempty" yaml:"display_name,omitempty"`
+	// Endpoints default to the network's RPC port on localhost.
+	Endpoints []EndpointConfig `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+}
+
+// Network is a configured network with its chain params and the client
+// of its endpoints.
+type Network struct {
+	NetworkConfig
+	Params  *qparams.Params
+	RPCPort string
+	rpc     *Client
+}
+
+// NetworkInfo describes a network for the qng_list_networks tool.
+type NetworkInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Default     bool   `json:"default,omitempty"`
+	// chain params from github.com/Qitmeer/qng/params
+	Genesis            string           `json:"genesis_hash"`
+	TargetTimePerBlock float64          `json:"target_seconds_per_block"`
+	CoinbaseMaturity   uint16           `json:"coinbase_maturity"`
+	P2PPort            string           `json:"p2p_port"`
+	RPCPort            string           `json:"rpc_port"`
+	Endpoints          []EndpointStatus `json:"endpoints"`
+}
+
+// networkNames lists the known networks in the order of qng's params.
+func networkNames() []string {
+	names := make([]string, 0, len(qparams.AllNetParams))
+	for _, p := range qparams.AllNetParams {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// chainParams returns the params and default RPC port of a network.
+func chainParams(name string) (*qparams.Params, string, bool) {
+	for _, p := range qparams.AllNetParams {
+		if p.Name == name {
+			return p.Params, p.RpcPort, true
+		}
+	}
+	return nil, "", false
+}
+
+// ParseNetworks parses the networks section of a networks file. ext selects
+// YAML for ".yaml" and ".yml" and JSON otherwise.
+func ParseNetworks(data []byte, ext string) ([]NetworkConfig, error) {
+	return parseNetworks(data, ext, "")
+}
+
+// parseNetworks parses a networks file, resolving the relative paths of
+// credential files against dir.
+func parseNetworks(data []byte, ext, dir string) ([]NetworkConfig, error) {
+	var config struct {
+		Networks []NetworkConfig `json:"networks" yaml:"networks"`
+	}
+	var err error
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	default:
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing networks: %v", err)
+	}
+	if len(config.Networks) == 0 {
+		return nil, fmt.Errorf("no networks configured")
+	}
+	seen := make(map[string]struct{}, len(config.Networks))
+	for i := range config.Networks {
+		n := &config.Networks[i]
+		_, rpcPort, ok := chainParams(n.Name)
+		if !ok {
+			return nil, fmt.Errorf("network %d: unknown network %q, expected one of %s", i, n.Name, strings.Join(networkNames(), ", "))
+		}
+		if _, ok := seen[n.Name]; ok {
+			return nil, fmt.Errorf("network %d: duplicate network %q", i, n.Name)
+		}
+		seen[n.Name] = struct{}{}
+		if n.DisplayName == "" {
+			n.DisplayName = "QNG " + strings.ToUpper(n.Name[:1]) + n.Name[1:]
+		}
+		if len(n.Endpoints) == 0 {
+			n.Endpoints = []EndpointConfig{{URL: "http://127.0.0.1:" + rpcPort + "/"}}
+		}
+		for j := range n.Endpoints {
+			e := &n.Endpoints[j]
+			if e.Network != "" && e.Network != n.Name {
+				return nil, fmt.Errorf("network %s: endpoint %d belongs to network %q", n.Name, j, e.Network)
+			}
+			e.Network = n.Name
+			if e.Auth != nil {
+				e.Auth.resolve(dir)
+			}
+			if e.TLS != nil {
+				e.TLS.resolve(dir)
+			}
+		}
+		if err := validateEndpoints(n.Endpoints); err != nil {
+			return nil, fmt.Errorf("network %s: %v", n.Name, err)
+		}
+	}
+	return config.Networks, nil
+}
+
+// LoadNetworksFile reads and validates the networks file stored at path.
+// Relative paths of credential files are taken from the file's directory.
+func LoadNetworksFile(path string) ([]NetworkConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseNetworks(data, filepath.Ext(path), filepath.Dir(path))
+}
+
+// NewNetworks returns a client for each network, the default one first. An
+// empty defaultName picks the first network.
+func NewNetworks(configs []NetworkConfig, defaultName string, opts ...ClientOption) ([]*Network, error) {
+	networks := make([]*Network, 0, len(configs))
+	for _, config := range configs {
+		params, rpcPort, ok := chainParams(config.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown network %q", config.Name)
+		}
+		n := &Network{
+			NetworkConfig: config,
+			Params:        params,
+			RPCPort:       rpcPort,
+			rpc:           NewFailoverClient(config.Endpoints, opts...),
+		}
+		if config.Name == defaultName {
+			networks = append([]*Network{n}, networks...)
+		} else {
+			networks = append(networks, n)
+		}
+	}
+	if defaultName != "" && (len(networks) == 0 || networks[0].Name != defaultName) {
+		return nil, fmt.Errorf("default network %q is not configured", defaultName)
+	}
+	return networks, nil
+}
+
+// Info describes the network and the state of its endpoints.
+func (n *Network) Info() NetworkInfo {
+	return NetworkInfo{
+		Name:               n.Name,
+		DisplayName:        n.DisplayName,
+		Genesis:            n.Params.GenesisHash.String(),
+		TargetTimePerBlock: n.Params.TargetTimePerBlock.Seconds(),
+		CoinbaseMaturity:   n.Params.CoinbaseMaturity,
+		P2PPort:            n.Params.DefaultPort,
+		RPCPort:            n.RPCPort,
+		Endpoints:          n.rpc.Endpoints(),
+	}
+}
+
+// networkMismatchError is returned for an endpoint whose node serves
+// another network than configured.
+type networkMismatchError struct {
+	Endpoint string
+	Expected string
+	Actual   string
+}
+
+func (e *networkMismatchError) Error() string {
+	return fmt.Sprintf("endpoint %s: wrong network: expected %s, node reports %q", e.Endpoint, e.Expected, e.Actual)
+}
+
+// checkNetwork asks the node behind e for its network with qng_getNodeInfo
+// unless e expects no network or was already verified.
+func (c *Client) checkNetwork(ctx context.Context, e *Endpoint) error {
+	if e.Network == "" || e.networkVerified.Load() {
+		return nil
+	}
+	var info struct {
+		Network string `json:"network"`
+	}
+	if err := c.callEndpoint(ctx, e, "qng_getNodeInfo", &info); err != nil {
+		return err
+	}
+	if info.Network != e.Network {
+		return &networkMismatchError{Endpoint: e.Name, Expected: e.Network, Actual: info.Network}
+	}
+	e.networkVerified.Store(true)
+	return nil
+}
+
+// VerifyNetwork checks that every endpoint serves the network it is
+// configured for. Endpoints that cannot be reached are taken out of
+// rotation until a health check verifies them; an endpoint serving another
+// network is an error.
+func (c *Client) VerifyNetwork(ctx context.Context) error {
+	var mismatches []error
+	for _, e := range c.endpoints {
+		if e.Network == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := c.checkNetwork(ctx, e)
+		cancel()
+		var mismatch *networkMismatchError
+		switch {
+		case errors.As(err, &mismatch):
+			e.setHealth(false, mismatch.Error())
+			mismatches = append(mismatches, err)
+		case err != nil:
+			e.setHealth(false, fmt.Sprintf("network not verified: %v", err))
+		default:
+			log.Info("Verified endpoint network", "endpoint", e.Name, "network", e.Network)
+		}
+	}
+	return errors.Join(mismatches...)
+}
+
+// configuredNetworks are the networks set with -networks; the first is the
+// default network.
+var configuredNetworks []*Network
+
+// networkDescription describes the network argument of the tools.
+func (s *MCPServer) networkDescription() string {
+	names := make([]string, len(s.networks))
+	for i, n := range s.networks {
+		names[i] = fmt.Sprintf("%s (%s)", n.Name, n.DisplayName)
+	}
+	return fmt.Sprintf("QNG network to query (optional, default %s). One of: %s.", s.networks[0].Name, strings.Join(names, ", "))
+}
+
+// withNetworkArg adds the network argument to the input schema of tool.
+func (s *MCPServer) withNetworkArg(tool mcp.Tool) mcp.Tool {
+	if len(s.networks) == 0 {
+		return tool
+	}
+	names := make([]string, len(s.networks))
+	for i, n := range s.networks {
+		names[i] = n.Name
+	}
+	properties := make(map[string]interface{}, len(tool.InputSchema.Properties)+1)
+	for k, v := range tool.InputSchema.Properties {
+		properties[k] = v
+	}
+	properties["network"] = map[string]interface{}{
+		"type":        ParamString,
+		"enum":        names,
+		"description": s.networkDescription(),
+	}
+	tool.InputSchema.Properties = properties
+	return tool
+}
+
+// networkArg returns the client of the optional network argument, the
+// server's client if it is omitted.
+func (s *MCPServer) networkArg(args map[string]interface{}) (*Client, error) {
+	v, ok := args["network"]
+	if !ok || v == nil || v == "" {
+		return s.rpc, nil
+	}
+	name, ok := v.(string)
+	if ok {
+		for _, n := range s.networks {
+			if n.Name == name {
+				return n.rpc, nil
+			}
+		}
+	}
+	if len(s.networks) == 0 {
+		return nil, invalidArgument("network", "invalid argument network: no networks are configured")
+	}
+	err := invalidArgument("network", "invalid argument network: unknown network %v", v)
+	err.Hint = s.networkDescription()
+	return nil, err
+}
+
+// networkInfos describes the configured networks.
+func (s *MCPServer) networkInfos() []NetworkInfo {
+	infos := make([]NetworkInfo, len(s.networks))
+	for i, n := range s.networks {
+		infos[i] = n.Info()
+	}
+	if len(infos) > 0 {
+		infos[0].Default = true
+	}
+	return infos
+}
+
+// handleListNetworks handles the qng_list_networks tool request.
+func (s *MCPServer) handleListNetworks(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	return jsonToolResult(s.networkInfos())
+}
+
+// handleNetworksResource serves the qng://networks resource.
+func (s *MCPServer) handleNetworksResource(
+	ctx context.Context,
+	request mcp.ReadResourceRequest,
+) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(s.networkInfos(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newNetworkNode serves a node of the given network whose block count is
+// count.
+func newNetworkNode(t *testing.T, network string, count int) *httptest.Server {
+	return newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		if method == "qng_getNodeInfo" {
+			return map[string]string{"network": network}, nil
+		}
+		return count, nil
+	})
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]byte(`networks:
+  - name: mainnet
+    display_name: Meer Mainnet
+    endpoints:
+      - url: https://qng.example.com/rpc
+  - name: testnet
+`), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if networks[0].DisplayName != "Meer Mainnet" || networks[1].DisplayName != "QNG Testnet" {
+		t.Errorf("Unexpected display names %+v", networks)
+	}
+	if networks[0].Endpoints[0].Network != "mainnet" {
+		t.Errorf("Expected endpoints to take the network of the profile, got %+v", networks[0].Endpoints[0])
+	}
+	if e := networks[1].Endpoints[0]; e.URL != "http://127.0.0.1:18131/" || e.Network != "testnet" {
+		t.Errorf("Expected the default testnet RPC port, got %+v", e)
+	}
+
+	for _, bad := range []string{
+		`{"networks": []}`,
+		`{"networks": [{"name": "devnet"}]}`,
+		`{"networks": [{"name": "mainnet"}, {"name": "mainnet"}]}`,
+		`{"networks": [{"name": "mainnet", "endpoints": [{"url": "http://a/", "network": "testnet"}]}]}`,
+	} {
+		if _, err := ParseNetworks([]byte(bad), ".json"); err == nil {
+			t.Errorf("Expected %s to be rejected", bad)
+		}
+	}
+	if _, err := ParseEndpoints([]byte(`{"endpoints": [{"url": "http://a/", "network": "devnet"}]}`), ".json"); err == nil {
+		t.Error("Expected an unknown endpoint network to be rejected")
+	}
+}
+
+func TestVerifyNetwork(t *testing.T) {
+	mainnet, testnet := newNetworkNode(t, "mainnet", 1), newNetworkNode(t, "testnet", 2)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c := NewFailoverClient([]EndpointConfig{
+		{Name: "good", URL: mainnet.URL, Network: "mainnet"},
+		{Name: "down", URL: down.URL, Network: "mainnet", Priority: 1},
+	}, WithRetryPolicy(func(string) RetryPolicy { return RetryPolicy{Timeout: healthCheckTimeout, MaxAttempts: 1} }))
+	if err := c.VerifyNetwork(context.Background()); err != nil {
+		t.Fatalf("Expected an unreachable endpoint not to fail verification, got %v", err)
+	}
+	status := c.Endpoints()
+	if !status[0].Healthy || status[1].Healthy || !strings.Contains(status[1].Reason, "not verified") {
+		t.Errorf("Expected only the verified endpoint to be healthy, got %+v", status)
+	}
+
+	c = NewFailoverClient([]EndpointConfig{{Name: "wrong", URL: testnet.URL, Network: "mainnet"}})
+	err := c.VerifyNetwork(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `node reports "testnet"`) {
+		t.Errorf("Expected a network mismatch, got %v", err)
+	}
+	c.CheckHealth(context.Background(), maxBlockLag)
+	if s := c.Endpoints()[0]; s.Healthy || !strings.Contains(s.Reason, "wrong network") {
+		t.Errorf("Expected health checks to keep the endpoint out, got %+v", s)
+	}
+}
+
+func TestNetworkArgument(t *testing.T) {
+	mainnet, testnet := newNetworkNode(t, "mainnet", 1), newNetworkNode(t, "testnet", 2)
+	networks, err := NewNetworks([]NetworkConfig{
+		{Name: "mainnet", DisplayName: "QNG Mainnet", Endpoints: []EndpointConfig{{URL: mainnet.URL, Network: "mainnet"}}},
+		{Name: "testnet", DisplayName: "QNG Testnet", Endpoints: []EndpointConfig{{URL: testnet.URL, Network: "testnet"}}},
+	}, "testnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if networks[0].Name != "testnet" {
+		t.Fatalf("Expected the default network first, got %s", networks[0].Name)
+	}
+	if _, err := NewNetworks([]NetworkConfig{{Name: "mainnet"}}, "privnet"); err == nil {
+		t.Error("Expected an unconfigured default network to be rejected")
+	}
+
+	configuredNetworks = networks
+	defer func() { configuredNetworks = nil }()
+	c := newTestClient(t, NewMCPServer(networks[0].rpc))
+
+	listed, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range listed.Tools {
+		if tool.Name != "qng_get_block_count" && tool.Name != "get_node_info" {
+			continue
+		}
+		prop, _ := tool.InputSchema.Properties["network"].(map[string]interface{})
+		if enum, _ := prop["enum"].([]interface{}); len(enum) != 2 || enum[0] != "testnet" {
+			t.Errorf("%s: expected a network enum, got %v", tool.Name, prop)
+		}
+	}
+
+	call := func(name string, args map[string]interface{}) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		result, err := c.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	text := func(result *mcp.CallToolResult) string {
+		return result.Content[0].(mcp.TextContent).Text
+	}
+	for network, want := range map[string]string{"": "2", "testnet": "2", "mainnet": "1"} {
+		if got := text(call("qng_get_block_count", map[string]interface{}{"network": network})); got != want {
+			t.Errorf("network %q: expected block count %s, got %s", network, want, got)
+		}
+	}
+	if got := text(call("get_node_info", map[string]interface{}{"network": "mainnet"})); !strings.Contains(got, "mainnet") {
+		t.Errorf("Expected the catalog tool to query mainnet, got %s", got)
+	}
+
+	result := call("qng_get_block_count", map[string]interface{}{"network": "devnet"})
+	var details map[string]interface{}
+	json.Unmarshal([]byte(text(result)), &details)
+	if !result.IsError || details["argument"] != "network" {
+		t.Errorf("Expected an invalid network argument, got %s", text(result))
+	}
+
+	var infos []NetworkInfo
+	if err := json.Unmarshal([]byte(text(call("qng_list_networks", nil))), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || !infos[0].Default || infos[1].RPCPort != "8131" || len(infos[1].Genesis) != 64 {
+		t.Errorf("Unexpected networks %+v", infos)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Formats narrow how a param value is validated and encoded for the node.
+const (
+	// FormatHash is a 32-byte hash given as 64 hex characters.
+	FormatHash = "hash"
+	// FormatHex is a quantity sent as a 0x-prefixed hex string.
+	FormatHex = "hex"
+	// FormatUint64 is an unsigned 64-bit integer.
+	FormatUint64 = "uint64"
+	// FormatBigInt is an arbitrary precision non-negative integer such as
+	// an amount in atoms.
+	FormatBigInt = "bigint"
+)
+
+// maxSafeInteger is the largest integer a JSON number decoded into float64
+// represents exactly.
+const maxSafeInteger = 1 << 53
+
+// hashPattern is the schema pattern advertised for FormatHash params.
+const hashPattern = "^(0x)?[0-9a-fA-F]{64}$"
+
+// formatTypes lists the param types each format may be combined with.
+var formatTypes = map[string][]string{
+	FormatHash:   {ParamString},
+	FormatHex:    {ParamString},
+	FormatUint64: {ParamInteger},
+	FormatBigInt: {ParamString, ParamInteger},
+}
+
+// validateFormat checks that format is known and fits typ.
+func validateFormat(typ, format string) error {
+	if format == "" {
+		return nil
+	}
+	types, ok := formatTypes[format]
+	if !ok {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	for _, t := range types {
+		if t == typ {
+			return nil
+		}
+	}
+	return fmt.Errorf("format %q cannot be used with type %q", format, typ)
+}
+
+// coerceParam converts the tool argument v into the value sent to the node
+// for p, as declared by its type and format. Errors name the argument so the
+// model can correct the call.
+func coerceParam(p Param, v interface{}) (interface{}, error) {
+	out, err := coerceValue(p, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid argument %s: %v", p.Name, err)
+	}
+	if len(p.Enum) > 0 {
+		s, _ := out.(string)
+		for _, e := range p.Enum {
+			if s == e {
+				return out, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid argument %s: %q is not one of %s", p.Name, s, strings.Join(p.Enum, ", "))
+	}
+	return out, nil
+}
+
+func coerceValue(p Param, v interface{}) (interface{}, error) {
+	switch p.Format {
+	case FormatHash:
+		return toHash(v)
+	case FormatHex:
+		n, err := toBigInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + n.Text(16), nil
+	case FormatUint64:
+		return toUint64(v)
+	case FormatBigInt:
+		return toBigInt(v)
+	}
+	switch p.Type {
+	case ParamString:
+		return toString(v)
+	case ParamInteger:
+		return toInt64(v)
+	case ParamNumber:
+		return toNumber(v)
+	case ParamBoolean:
+		return toBool(v)
+	case ParamArray:
+		return toStringArray(v)
+	}
+	return v, nil
+}
+
+// toString accepts strings, and integral numbers a model sent unquoted.
+func toString(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case float64:
+		if x != math.Trunc(x) || math.Abs(x) > maxSafeInteger {
+			return "", fmt.Errorf("expected a string, got number %v; quote the value", x)
+		}
+		return strconv.FormatInt(int64(x), 10), nil
+	}
+	return "", fmt.Errorf("expected a string, got %T", v)
+}
+
+// toHash accepts a 32-byte hash of 64 hex characters, with or without a 0x
+// prefix, and returns it without the prefix as the node expects it.
+func toHash(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a 64 character hex hash string, got %T", v)
+	}
+	s = strings.TrimSpace(s)
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(digits) != 64 {
+		return "", fmt.Errorf("expected a 32-byte hash of 64 hex characters, got %d characters", len(digits))
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", fmt.Errorf("hash contains non-hex characters")
+	}
+	return digits, nil
+}
+
+// toBool accepts booleans and the strings "true" and "false".
+func toBool(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(x))
+		if err != nil {
+			return false, fmt.Errorf("expected true or false, got %q", x)
+		}
+		return b, nil
+	}
+	return false, fmt.Errorf("expected a boolean, got %T", v)
+}
+
+func toNumber(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("expected a number, got %q", x)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
+
+func toInt64(v interface{}) (int64, error) {
+	n, err := toSignedBigInt(v)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsInt64() {
+		return 0, fmt.Errorf("%s does not fit in a 64-bit integer", n)
+	}
+	return n.Int64(), nil
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	n, err := toBigInt(v)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() {
+		return 0, fmt.Errorf("%s does not fit in an unsigned 64-bit integer", n)
+	}
+	return n.Uint64(), nil
+}
+
+// toBigInt parses a non-negative integer.
+func toBigInt(v interface{}) (*big.Int, error) {
+	n, err := toSignedBigInt(v)
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("expected a non-negative integer, got %s", n)
+	}
+	return n, nil
+}
+
+// toSignedBigInt parses an integer given as a JSON number, a decimal string
+// or a 0x-prefixed hex string. Numbers beyond 2^53 are rejected because they
+// were already rounded when the arguments were decoded.
+func toSignedBigInt(v interface{}) (*big.Int, error) {
+	switch x := v.(type) {
+	case float64:
+		if x != math.Trunc(x) || math.IsInf(x, 0) {
+			return nil, fmt.Errorf("expected an integer, got %v", x)
+		}
+		if math.Abs(x) > maxSafeInteger {
+			return nil, fmt.Errorf("%v is too large to be sent as a JSON number; pass it as a decimal or 0x-hex string", x)
+		}
+		return big.NewInt(int64(x)), nil
+	case string:
+		s := strings.TrimSpace(x)
+		base := 10
+		if digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"); digits != s {
+			s, base = digits, 16
+		}
+		if s == "" || strings.HasPrefix(s, "+") || (base == 16 && strings.HasPrefix(s, "-")) {
+			return nil, fmt.Errorf("expected an integer, got %q", x)
+		}
+		n, ok := new(big.Int).SetString(s, base)
+		if !ok {
+			return nil, fmt.Errorf("expected a decimal or 0x-hex integer, got %q", x)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("expected an integer, got %T", v)
+}
+
+// toStringArray accepts a JSON array of strings or a comma separated string.
+func toStringArray(v interface{}) ([]string, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		out := make([]string, 0, len(x))
+		for i, e := range x {
+			s, err := toString(e)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	case string:
+		if strings.TrimSpace(x) == "" {
+			return []string{}, nil
+		}
+		parts := strings.Split(x, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return parts, nil
+	}
+	return nil, fmt.Errorf("expected an array, got %T", v)
+}
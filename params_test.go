@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCoerceParam(t *testing.T) {
+	digitsHash := strings.Repeat("1234567890", 6) + "1234"
+	testCases := []struct {
+		param   Param
+		input   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		// a hash made only of digits must stay a string
+		{Param{Name: "block_hash", Type: ParamString, Format: FormatHash}, digitsHash, digitsHash, ""},
+		{Param{Name: "block_hash", Type: ParamString, Format: FormatHash}, "0x" + digitsHash, digitsHash, ""},
+		{Param{Name: "block_hash", Type: ParamString, Format: FormatHash}, " 0X" + strings.Repeat("ab", 32), strings.Repeat("ab", 32), ""},
+		{Param{Name: "block_hash", Type: ParamString, Format: FormatHash}, "0x" + strings.Repeat("ab", 33), nil, "64 hex characters"},
+		{Param{Name: "block_hash", Type: ParamString, Format: FormatHash}, "abc", nil, "block_hash"},
+		{Param{Name: "block_hash", Type: ParamString, Format: FormatHash}, strings.Repeat("zz", 32), nil, "non-hex"},
+		{Param{Name: "id", Type: ParamString}, "0x00ff", "0x00ff", ""},
+		{Param{Name: "verbose", Type: ParamBoolean}, "true", true, ""},
+		{Param{Name: "verbose", Type: ParamBoolean}, "yes", nil, "verbose"},
+		{Param{Name: "order", Type: ParamInteger}, float64(1000), int64(1000), ""},
+		{Param{Name: "order", Type: ParamInteger}, "0x10", int64(16), ""},
+		{Param{Name: "order", Type: ParamInteger}, 1.5, nil, "order"},
+		{Param{Name: "vout", Type: ParamInteger, Format: FormatUint64}, "18446744073709551615", uint64(18446744073709551615), ""},
+		{Param{Name: "vout", Type: ParamInteger, Format: FormatUint64}, float64(-1), nil, "non-negative"},
+		{Param{Name: "vout", Type: ParamInteger, Format: FormatUint64}, 1e17, nil, "too large"},
+		{Param{Name: "gas", Type: ParamString, Format: FormatHex}, float64(255), "0xff", ""},
+		{Param{Name: "gas", Type: ParamString, Format: FormatHex}, "0x00ff", "0xff", ""},
+		{Param{Name: "mode", Type: ParamString, Enum: []string{"a", "b"}}, "c", nil, "not one of"},
+		{Param{Name: "addrs", Type: ParamArray}, "a, b", []string{"a", "b"}, ""},
+	}
+	for _, tc := range testCases {
+		got, err := coerceParam(tc.param, tc.input)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s(%v): expected error containing %q, got %v", tc.param.Name, tc.input, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s(%v): unexpected error: %v", tc.param.Name, tc.input, err)
+			continue
+		}
+		if s, ok := tc.want.([]string); ok {
+			if strings.Join(got.([]string), "|") != strings.Join(s, "|") {
+				t.Errorf("%s(%v): expected %v, got %v", tc.param.Name, tc.input, tc.want, got)
+			}
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s(%v): expected %v (%T), got %v (%T)", tc.param.Name, tc.input, tc.want, tc.want, got, got)
+		}
+	}
+
+	amount, err := coerceParam(Param{Name: "amount", Type: ParamString, Format: FormatBigInt}, "123456789012345678901234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount.(*big.Int).String() != "123456789012345678901234567890" {
+		t.Errorf("Big amount was not preserved: %v", amount)
+	}
+}
+
+func FuzzCoerceHash(f *testing.F) {
+	f.Add(strings.Repeat("ab", 32))
+	f.Add("0x" + strings.Repeat("01", 32))
+	f.Add(strings.Repeat("9", 64))
+	f.Add("xyz")
+	p := Param{Name: "block_hash", Type: ParamString, Format: FormatHash}
+	f.Fuzz(func(t *testing.T, s string) {
+		out, err := coerceParam(p, s)
+		if err != nil {
+			if !strings.Contains(err.Error(), p.Name) {
+				t.Fatalf("error does not name the argument: %v", err)
+			}
+			return
+		}
+		b, err := hex.DecodeString(out.(string))
+		if err != nil || len(b) != 32 {
+			t.Fatalf("accepted %q which is not a 32-byte hash", s)
+		}
+	})
+}
+
+func FuzzCoerceInteger(f *testing.F) {
+	f.Add("0")
+	f.Add("18446744073709551615")
+	f.Add("0xffffffffffffffff")
+	f.Add("-1")
+	f.Add("0x")
+	f.Add("1e3")
+	formats := []Param{
+		{Name: "n", Type: ParamInteger},
+		{Name: "n", Type: ParamInteger, Format: FormatUint64},
+		{Name: "n", Type: ParamString, Format: FormatBigInt},
+		{Name: "n", Type: ParamString, Format: FormatHex},
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, p := range formats {
+			out, err := coerceParam(p, s)
+			if err != nil {
+				if !strings.Contains(err.Error(), p.Name) {
+					t.Fatalf("error does not name the argument: %v", err)
+				}
+				continue
+			}
+			// every accepted value must round trip through its own encoding
+			var text string
+			switch v := out.(type) {
+			case int64:
+				text = big.NewInt(v).String()
+			case uint64:
+				text = new(big.Int).SetUint64(v).String()
+			case *big.Int:
+				text = v.String()
+			case string:
+				text = v
+			default:
+				t.Fatalf("%s: unexpected output type %T", p.Format, out)
+			}
+			again, err := coerceParam(p, text)
+			if err != nil {
+				t.Fatalf("%s: %q was accepted as %v but its encoding %q is rejected: %v", p.Format, s, out, text, err)
+			}
+			if a, b := again, out; a != b {
+				if ab, ok := a.(*big.Int); !ok || ab.Cmp(b.(*big.Int)) != 0 {
+					t.Fatalf("%s: %q does not round trip: %v != %v", p.Format, s, a, b)
+				}
+			}
+		}
+	})
+}
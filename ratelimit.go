@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ExpensiveAlways marks every call of a catalog method as expensive, see
+// Method.Expensive.
+const ExpensiveAlways = "always"
+
+// RateLimitConfig bounds the rate of requests sent to an endpoint with token
+// buckets. Calls of expensive methods draw on both budgets.
+type RateLimitConfig struct {
+	// Rate is the sustained number of requests per second and Burst how
+	// many may be sent at once, a second's worth if 0. A Rate of 0 leaves
+	// requests unlimited.
+	Rate  float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// ExpensiveRate and ExpensiveBurst budget the calls of expensive
+	// methods, such as state roots and blocks with full transactions.
+	ExpensiveRate  float64 `json:"expensive_rate,omitempty" yaml:"expensive_rate,omitempty"`
+	ExpensiveBurst int     `json:"expensive_burst,omitempty" yaml:"expensive_burst,omitempty"`
+	// FailFast turns over-limit requests away at once. Otherwise they wait
+	// for their turn if it comes before their deadline.
+	FailFast bool `json:"fail_fast,omitempty" yaml:"fail_fast,omitempty"`
+}
+
+// defaultRateLimitConfig applies to endpoints that do not set their own.
+// The rate limit flags update it at startup.
+var defaultRateLimitConfig RateLimitConfig
+
+// validate checks the rates and bursts of c.
+func (c RateLimitConfig) validate() error {
+	if c.Rate < 0 || c.ExpensiveRate < 0 || c.Burst < 0 || c.ExpensiveBurst < 0 {
+		return fmt.Errorf("negative rate limit")
+	}
+	return nil
+}
+
+// rateCost is what a request draws from the rate limits of an endpoint: one
+// token per call, and one from the expensive budget per expensive call.
+type rateCost struct {
+	calls     int
+	expensive int
+}
+
+// tokenBucket holds up to burst tokens and gains rate tokens per second.
+// Tokens are reserved ahead of time, so they go negative while requests
+// wait for their turn.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket, or nil if rate is 0. A burst of 0
+// holds a second's worth of tokens.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Max(math.Ceil(rate), 1)
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b}
+}
+
+// reserve takes n tokens at now and returns how long until they are earned.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	if b == nil || n == 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// refund returns n tokens reserved by a request that was not sent.
+func (b *tokenBucket) refund(n int) {
+	if b != nil {
+		b.tokens = math.Min(b.burst, b.tokens+float64(n))
+	}
+}
+
+// rateLimiter holds the token buckets of an endpoint.
+type rateLimiter struct {
+	name     string
+	failFast bool
+
+	mu        sync.Mutex
+	calls     *tokenBucket
+	expensive *tokenBucket
+}
+
+func newRateLimiter(name string, config RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		name:      name,
+		failFast:  config.FailFast,
+		calls:     newTokenBucket(config.Rate, config.Burst),
+		expensive: newTokenBucket(config.ExpensiveRate, config.ExpensiveBurst),
+	}
+}
+
+// wait takes the tokens of a request, waiting for them until ctx ends or
+// timeout passes. It fails fast with a *backoffError telling when to retry
+// if the tokens would come later, or at once if the limiter fails fast.
+func (r *rateLimiter) wait(ctx context.Context, cost rateCost, timeout time.Duration) error {
+	if r.calls == nil && r.expensive == nil {
+		return nil
+	}
+	now := time.Now()
+	r.mu.Lock()
+	delay := r.calls.reserve(now, cost.calls)
+	reason := "rate_limited"
+	if d := r.expensive.reserve(now, cost.expensive); d > delay {
+		delay, reason = d, "expensive_rate_limited"
+	}
+	if delay == 0 {
+		r.mu.Unlock()
+		return nil
+	}
+	deadline := now.Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if r.failFast || now.Add(delay).After(deadline) {
+		r.calls.refund(cost.calls)
+		r.expensive.refund(cost.expensive)
+		r.mu.Unlock()
+		return &backoffError{Endpoint: r.name, Reason: reason, RetryAfter: delay}
+	}
+	r.mu.Unlock()
+
+	metrics.Inc("rpc_rate_limit_waits_total", "endpoint", r.name)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.refund(cost)
+		return ctx.Err()
+	}
+}
+
+// refund returns the tokens taken by wait for a request that was not sent.
+func (r *rateLimiter) refund(cost rateCost) {
+	if r.calls == nil && r.expensive == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls.refund(cost.calls)
+	r.expensive.refund(cost.expensive)
+}
+
+// validateExpensive checks the expensive field of a catalog method: always,
+// or the name of a boolean param that makes a call expensive when true.
+func (m Method) validateExpensive() error {
+	if m.Expensive == "" || m.Expensive == ExpensiveAlways {
+		return nil
+	}
+	for _, p := range m.Params {
+		if p.Name == m.Expensive {
+			if p.Type != ParamBoolean {
+				return fmt.Errorf("expensive param %q is not a boolean", p.Name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown expensive param %q", m.Expensive)
+}
+
+// expensiveCall reports whether a call of method with params is expensive
+// according to the catalog. A missing param takes its catalog default.
+func expensiveCall(method string, params []interface{}) bool {
+	methods, err := GetMethods()
+	if err != nil {
+		return false
+	}
+	for _, m := range methods {
+		if m.Name != method || m.Expensive == "" {
+			continue
+		}
+		if m.Expensive == ExpensiveAlways {
+			return true
+		}
+		for i, p := range m.Params {
+			if p.Name != m.Expensive {
+				continue
+			}
+			v := p.Default
+			if i < len(params) && params[i] != nil {
+				v = params[i]
+			}
+			// params may be coerced tool arguments; the node sees their
+			// JSON form
+			var on bool
+			data, err := json.Marshal(v)
+			return err == nil && json.Unmarshal(data, &on) == nil && on
+		}
+	}
+	return false
+}
+
+// callCost returns the rate cost of a call of method with params.
+func callCost(method string, params []interface{}) rateCost {
+	cost := rateCost{calls: 1}
+	if expensiveCall(method, params) {
+		cost.expensive = 1
+	}
+	return cost
+}
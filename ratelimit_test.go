@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := newRateLimiter("rate-test", RateLimitConfig{Rate: 20, Burst: 2, ExpensiveRate: 1, ExpensiveBurst: 1})
+	ctx := context.Background()
+	call, expensive := rateCost{calls: 1}, rateCost{calls: 1, expensive: 1}
+
+	for i := 0; i < 2; i++ {
+		if err := r.wait(ctx, call, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the third request waits for its token
+	start := time.Now()
+	if err := r.wait(ctx, call, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("Expected an over-limit request to wait, it took %s", d)
+	}
+
+	// a token that comes after the deadline is not waited for
+	var backoffErr *backoffError
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := r.wait(short, call, time.Second); !errors.As(err, &backoffErr) || backoffErr.Reason != "rate_limited" || backoffErr.RetryAfter <= 0 {
+		t.Errorf("Expected a request that cannot wait to fail fast, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := r.wait(ctx, expensive, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.wait(ctx, expensive, 10*time.Millisecond); !errors.As(err, &backoffErr) || backoffErr.Reason != "expensive_rate_limited" {
+		t.Errorf("Expected the expensive budget to run out, got %v", err)
+	}
+	if err := r.wait(ctx, call, 10*time.Millisecond); err != nil {
+		t.Errorf("Expected cheap calls to keep their budget, got %v", err)
+	}
+
+	r = newRateLimiter("rate-test", RateLimitConfig{Rate: 1, Burst: 1, FailFast: true})
+	r.wait(ctx, call, time.Minute)
+	if err := r.wait(ctx, call, time.Minute); !errors.As(err, &backoffErr) {
+		t.Errorf("Expected a fail fast limiter not to wait, got %v", err)
+	}
+	if err := newRateLimiter("rate-test", RateLimitConfig{}).wait(ctx, expensive, 0); err != nil {
+		t.Errorf("Expected no limit by default, got %v", err)
+	}
+}
+
+func TestExpensiveCall(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		params []interface{}
+		want   bool
+	}{
+		{"qng_getStateRoot", []interface{}{1, true}, true},
+		{"qng_getRawTransactions", []interface{}{"Tm..."}, true},
+		{"qng_getBlockByOrder", []interface{}{1, true}, true},
+		{"qng_getBlockByOrder", []interface{}{1, true, true, false}, false},
+		{"qng_getBlockByID", []interface{}{1}, false},
+		{"qng_getBlockByNum", []interface{}{1, true, true, true}, true},
+		{"qng_getBlockCount", nil, false},
+	} {
+		if got := expensiveCall(tc.method, tc.params); got != tc.want {
+			t.Errorf("%s %v: expected expensive %v, got %v", tc.method, tc.params, tc.want, got)
+		}
+	}
+
+	bad := QngMethods{{Name: "qng_a", Call: "a", Expensive: "verbose", Params: Params{{Name: "verbose", Type: ParamString}}}}
+	if err := bad.Validate(); err == nil {
+		t.Error("Expected a non-boolean expensive param to be rejected")
+	}
+	bad[0].Expensive = "full_tx"
+	if err := bad.Validate(); err == nil {
+		t.Error("Expected an unknown expensive param to be rejected")
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage(`{"order":1}`)})
+	}))
+	defer srv.Close()
+
+	c := NewFailoverClient([]EndpointConfig{{URL: srv.URL, RateLimit: &RateLimitConfig{Rate: 100, ExpensiveRate: 0.5, ExpensiveBurst: 1, FailFast: true}}},
+		WithRateLimit(RateLimitConfig{Rate: 0.1, Burst: 1, FailFast: true}))
+	ctx := context.Background()
+	if _, err := c.GetBlockByOrder(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallRaw(ctx, "qng_getBlockCount", nil); err != nil {
+		t.Errorf("Expected the endpoint's own limit to apply, got %v", err)
+	}
+	_, err := c.GetBlockByOrder(ctx, 2)
+	toolErr := asToolError("qng_getBlockByOrder", err)
+	if toolErr.Kind != ErrorUnavailable || toolErr.Class != "expensive_rate_limited" || toolErr.RetryAfter != 2 || toolErr.Hint == "" {
+		t.Errorf("Expected a retry-after hint, got %+v", toolErr)
+	}
+	if s := c.Endpoints()[0]; s.Rejected != 1 {
+		t.Errorf("Expected the rejected request to be counted, got %d", s.Rejected)
+	}
+}
+
+// TestRateLimitRefund checks that requests the breaker turns away do not use
+// up the rate limit.
+func TestRateLimitRefund(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: time.Second, MaxAttempts: 1}
+	}
+	c := NewClient(srv.URL, WithRetryPolicy(once), WithBreaker(BreakerConfig{Failures: 1, Cooldown: time.Minute}),
+		WithRateLimit(RateLimitConfig{Rate: 0.1, Burst: 2, FailFast: true}))
+	for i := 0; i < 3; i++ {
+		_, err := c.CallRaw(context.Background(), "qng_getNodeInfo", nil)
+		toolErr := asToolError("qng_getNodeInfo", err)
+		if i > 0 && toolErr.Class != "circuit_open" {
+			t.Errorf("Expected call %d to be turned away by the breaker, got %+v", i, toolErr)
+		}
+	}
+	if tokens := c.endpoints[0].rate.calls.tokens; tokens < 1 {
+		t.Errorf("Expected the tokens of rejected requests to be refunded, %v left", tokens)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error classes a retry policy may retry on.
+const (
+	// RetryTimeout covers attempts that ran out of time.
+	RetryTimeout = "timeout"
+	// RetryConnection covers transport failures such as refused or reset
+	// connections.
+	RetryConnection = "connection"
+	// RetryHTTP5xx covers 5xx responses from the node or a proxy.
+	RetryHTTP5xx = "http_5xx"
+	// RetryHTTP429 covers rate limited responses.
+	RetryHTTP429 = "http_429"
+)
+
+var retryClasses = map[string]struct{}{
+	RetryTimeout:    {},
+	RetryConnection: {},
+	RetryHTTP5xx:    {},
+	RetryHTTP429:    {},
+}
+
+// Duration is a time.Duration that decodes from strings such as "90s" or
+// from a number of seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var v interface{}
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration) set(v interface{}) error {
+	switch x := v.(type) {
+	case string:
+		p, err := time.ParseDuration(x)
+		if err != nil {
+			return err
+		}
+		*d = Duration(p)
+	case float64:
+		*d = Duration(x * float64(time.Second))
+	case int:
+		*d = Duration(time.Duration(x) * time.Second)
+	default:
+		return fmt.Errorf("invalid duration %v", v)
+	}
+	return nil
+}
+
+// Backoff is the delay between attempts: Initial after the first failure,
+// multiplied by Multiplier after every further one and capped at Max.
+type Backoff struct {
+	Initial    Duration `json:"initial,omitempty" yaml:"initial,omitempty"`
+	Max        Duration `json:"max,omitempty" yaml:"max,omitempty"`
+	Multiplier float64  `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+}
+
+// RetryPolicy controls how a single RPC method is attempted.
+type RetryPolicy struct {
+	// Timeout bounds each attempt.
+	Timeout time.Duration
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	Backoff     Backoff
+	// RetryOn lists the error classes that are retried.
+	RetryOn []string
+}
+
+// defaultRetryPolicy applies to methods that do not override a field. The
+// timeout and retry flags update it at startup.
+var defaultRetryPolicy = RetryPolicy{
+	Timeout:     40 * time.Second,
+	MaxAttempts: 2,
+	Backoff: Backoff{
+		Initial:    Duration(time.Second),
+		Max:        Duration(10 * time.Second),
+		Multiplier: 2,
+	},
+	RetryOn: []string{RetryConnection, RetryHTTP5xx, RetryHTTP429},
+}
+
+// validatePolicy checks the retry fields of a catalog method.
+func (m Method) validatePolicy() error {
+	if m.Timeout < 0 {
+		return fmt.Errorf("negative timeout")
+	}
+	if m.MaxAttempts < 0 {
+		return fmt.Errorf("negative max_attempts")
+	}
+	if b := m.Backoff; b != nil {
+		if b.Initial < 0 || b.Max < 0 {
+			return fmt.Errorf("negative backoff")
+		}
+		if b.Multiplier != 0 && b.Multiplier < 1 {
+			return fmt.Errorf("backoff multiplier must be at least 1")
+		}
+	}
+	for _, c := range m.RetryOn {
+		if _, ok := retryClasses[c]; !ok {
+			return fmt.Errorf("unknown retry class %q", c)
+		}
+	}
+	return nil
+}
+
+// policyFor returns the retry policy of the RPC method name, with the fields
+// its catalog entry leaves empty taken from defaultRetryPolicy.
+func policyFor(name string) RetryPolicy {
+	policy := defaultRetryPolicy
+	methods, err := GetMethods()
+	if err != nil {
+		return policy
+	}
+	for _, m := range methods {
+		if m.Name != name {
+			continue
+		}
+		if m.Timeout > 0 {
+			policy.Timeout = time.Duration(m.Timeout)
+		}
+		if m.MaxAttempts > 0 {
+			policy.MaxAttempts = m.MaxAttempts
+		}
+		if b := m.Backoff; b != nil {
+			if b.Initial > 0 {
+				policy.Backoff.Initial = b.Initial
+			}
+			if b.Max > 0 {
+				policy.Backoff.Max = b.Max
+			}
+			if b.Multiplier > 0 {
+				policy.Backoff.Multiplier = b.Multiplier
+			}
+		}
+		if m.RetryOn != nil {
+			policy.RetryOn = m.RetryOn
+		}
+		break
+	}
+	return policy
+}
+
+// delay returns how long to wait after the given failed attempt (1-based).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.Backoff.Initial)
+	for i := 1; i < attempt; i++ {
+		d *= p.Backoff.Multiplier
+		if max := float64(p.Backoff.Max); max > 0 && d >= max {
+			return time.Duration(max)
+		}
+	}
+	if max := p.Backoff.Max; max > 0 && Duration(d) > max {
+		return time.Duration(max)
+	}
+	return time.Duration(d)
+}
+
+// retries reports whether a failure of class is retried.
+func (p RetryPolicy) retries(class string) bool {
+	for _, c := range p.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// httpStatusError is returned for a response with a status other than 200.
+type httpStatusError int
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP error: %d", int(e))
+}
+
+// classifyError maps a failed attempt to its retry class. status is the
+// HTTP status code, or 0 if no response was received. Requests an endpoint
+// rejected without being contacted have no class and are not retried.
+func classifyError(err error, status int) string {
+	var backoffErr *backoffError
+	switch {
+	case errors.As(err, &backoffErr), isBlockedAddress(err), isCassetteMiss(err):
+		return ""
+	case status == 429:
+		return RetryHTTP429
+	case status >= 500:
+		return RetryHTTP5xx
+	case status != 0:
+		return ""
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return RetryTimeout
+	}
+	return RetryConnection
+}
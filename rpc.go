@@ -0,0 +1,833 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	qjson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/log"
+)
+
+// Client is a JSON-RPC client for one or more QNG node endpoints. Requests
+// go to the preferred healthy endpoint and fail over to the next one on
+// connection errors and timeouts. Each endpoint has a circuit breaker and a
+// concurrency limiter that fail requests fast while it is failing or
+// overloaded. It is safe for concurrent use.
+type Client struct {
+	// endpoints is sorted by priority.
+	endpoints []*Endpoint
+	// adhoc holds the endpoints of clients made by WithEndpoint, so their
+	// breakers and limiters outlive a single call.
+	adhoc      *adhocEndpoints
+	httpClient *http.Client
+	// auth is sent as the Authorization header when set.
+	auth string
+	// timeout overrides the per-attempt timeout of every method when set.
+	timeout time.Duration
+	// policy returns the retry policy of a method.
+	policy      func(method string) RetryPolicy
+	breaker     BreakerConfig
+	concurrency ConcurrencyConfig
+	rateLimit   RateLimitConfig
+	// cache holds the results of immutable chain data, nil if disabled.
+	// Clients made by WithEndpoint do not cache.
+	cache *responseCache
+	// flights coalesces identical concurrent requests; clients made by
+	// WithEndpoint share it.
+	flights *flightGroup
+	// cassette records or replays the traffic of the client when set.
+	cassette *Cassette
+	nextID   atomic.Uint64
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the client send its requests through hc, for example
+// to share a transport between clients.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithAuthorization sets the Authorization header sent with every request.
+func WithAuthorization(auth string) ClientOption {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithTimeout bounds every attempt by d instead of the method's timeout.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithRetryPolicy replaces the catalog lookup of retry policies.
+func WithRetryPolicy(policy func(method string) RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.policy = policy
+	}
+}
+
+// WithBreaker sets the circuit breaker of every endpoint.
+func WithBreaker(config BreakerConfig) ClientOption {
+	return func(c *Client) {
+		c.breaker = config
+	}
+}
+
+// WithConcurrency bounds the requests in flight to every endpoint.
+func WithConcurrency(config ConcurrencyConfig) ClientOption {
+	return func(c *Client) {
+		c.concurrency = config
+	}
+}
+
+// WithRateLimit sets the rate limit of every endpoint that does not set its
+// own.
+func WithRateLimit(config RateLimitConfig) ClientOption {
+	return func(c *Client) {
+		c.rateLimit = config
+	}
+}
+
+// newHTTPClient returns an HTTP client with connection pooling. Requests are
+// bounded by the per-method timeout of their RetryPolicy rather than a client
+// timeout.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+			// 增加连接超时设置
+			TLSHandshakeTimeout: 15 * time.Second,
+			// 添加连接保活设置
+			DisableKeepAlives:  false,
+			MaxConnsPerHost:    20,
+			DisableCompression: false,
+		},
+	}
+}
+
+// NewClient returns a client for the node at endpoint. Unless an option says
+// otherwise it owns its HTTP transport and takes retry policies from the
+// method catalog, see policyFor.
+func NewClient(endpoint string, opts ...ClientOption) *Client {
+	return NewFailoverClient([]EndpointConfig{{URL: endpoint}}, opts...)
+}
+
+// NewFailoverClient returns a client for the given endpoints, preferring
+// those with the lowest priority.
+func NewFailoverClient(endpoints []EndpointConfig, opts ...ClientOption) *Client {
+	c := &Client{
+		adhoc:       newAdhocEndpoints(),
+		flights:     new(flightGroup),
+		policy:      policyFor,
+		breaker:     defaultBreakerConfig,
+		concurrency: defaultConcurrencyConfig,
+		rateLimit:   defaultRateLimitConfig,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = newHTTPClient()
+	}
+	for _, e := range endpoints {
+		c.endpoints = append(c.endpoints, c.newEndpoint(e))
+	}
+	sortEndpoints(c.endpoints)
+	if c.cache != nil {
+		if len(endpoints) > 0 && endpoints[0].Network != "" {
+			c.cache.namespace = endpoints[0].Network
+		} else if c.cache.config.Disk != nil {
+			// start looking up the node's network now, so that it is
+			// known by the time the first results come in
+			c.cache.lookupNamespace = c.nodeNetwork
+			c.cache.diskNamespace()
+		}
+	}
+	return c
+}
+
+// nodeNetwork asks the node for the network it serves.
+func (c *Client) nodeNetwork() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	var info struct {
+		Network string `json:"network"`
+	}
+	if err := c.Call(ctx, "qng_getNodeInfo", nil, &info); err != nil {
+		return "", err
+	}
+	if info.Network == "" {
+		return "", errors.New("qng_getNodeInfo reports no network")
+	}
+	return info.Network, nil
+}
+
+// newEndpoint returns an endpoint with the client's breaker and limiter
+// settings. Websocket endpoints get a connection of their own; IPC
+// endpoints talk to a unix domain socket.
+func (c *Client) newEndpoint(config EndpointConfig) *Endpoint {
+	rateLimit := c.rateLimit
+	if config.RateLimit != nil {
+		rateLimit = *config.RateLimit
+	}
+	e := newEndpoint(config, c.breaker, c.concurrency, rateLimit)
+	authorize, tlsConfig, err := config.credentials()
+	if err != nil {
+		// validateEndpoints reports this at startup for configured endpoints
+		e.credentialsErr = fmt.Errorf("endpoint %s: %v", e.Name, err)
+		e.setHealth(false, e.credentialsErr.Error())
+	}
+	e.authorize = authorize
+	if tlsConfig != nil {
+		transport, ok := c.httpClient.Transport.(*http.Transport)
+		if ok {
+			transport = transport.Clone()
+		} else {
+			transport = newHTTPClient().Transport.(*http.Transport)
+		}
+		transport.TLSClientConfig = tlsConfig
+		e.httpClient = &http.Client{Transport: transport}
+	}
+	if isWebsocketURL(e.URL) {
+		e.ws = newWSConn(e.Name, e.URL, func() uint64 { return c.nextID.Add(1) })
+		e.ws.authorize = func() (string, error) { return c.authorization(e) }
+		e.ws.tlsConfig = tlsConfig
+	}
+	e.ipc = ipcPath(e.URL)
+	return e
+}
+
+// authorization returns the Authorization header of a request to e: its
+// own credentials, or those of the client.
+func (c *Client) authorization(e *Endpoint) (string, error) {
+	if e.authorize != nil {
+		return e.authorize()
+	}
+	return c.auth, nil
+}
+
+// Endpoint returns the URL of the endpoint requests currently go to first,
+// without its password, so that it can be logged.
+func (c *Client) Endpoint() string {
+	return redactURL(c.candidates()[0].URL)
+}
+
+// WithEndpoint returns a client for a single endpoint that shares the
+// transport and settings of c. A configured endpoint keeps its credentials,
+// and clients for the same endpoint share its breaker and limiter.
+func (c *Client) WithEndpoint(endpoint string) *Client {
+	return c.withEndpoint(endpoint, nil)
+}
+
+// adhocKey identifies the endpoints made by withEndpoint. Endpoints that
+// use their own HTTP client are kept apart from those that share c's.
+type adhocKey struct {
+	url     string
+	guarded bool
+}
+
+// maxAdhocEndpoints bounds the endpoints kept for clients made by
+// WithEndpoint. Callers choose their URLs, so the least recently used
+// endpoints are dropped beyond it.
+const maxAdhocEndpoints = 64
+
+// adhocEntry is an endpoint made by withEndpoint.
+type adhocEntry struct {
+	key      adhocKey
+	endpoint *Endpoint
+}
+
+// adhocEndpoints is an LRU set of the endpoints made by withEndpoint. It is
+// safe for concurrent use.
+type adhocEndpoints struct {
+	mu      sync.Mutex
+	entries map[adhocKey]*list.Element
+	lru     *list.List
+}
+
+func newAdhocEndpoints() *adhocEndpoints {
+	return &adhocEndpoints{
+		entries: make(map[adhocKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the endpoint kept under key, or one made by create.
+func (a *adhocEndpoints) get(key adhocKey, create func() *Endpoint) *Endpoint {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if el, ok := a.entries[key]; ok {
+		a.lru.MoveToFront(el)
+		return el.Value.(*adhocEntry).endpoint
+	}
+	e := create()
+	a.entries[key] = a.lru.PushFront(&adhocEntry{key: key, endpoint: e})
+	for a.lru.Len() > maxAdhocEndpoints {
+		el := a.lru.Back()
+		old := el.Value.(*adhocEntry)
+		a.lru.Remove(el)
+		delete(a.entries, old.key)
+		if old.endpoint.ws != nil {
+			old.endpoint.ws.close()
+		}
+	}
+	return e
+}
+
+// withEndpoint is WithEndpoint for an endpoint that is not configured
+// sending its requests through httpClient, when set.
+func (c *Client) withEndpoint(endpoint string, httpClient *http.Client) *Client {
+	var e *Endpoint
+	for _, configured := range c.endpoints {
+		if configured.URL == endpoint {
+			e = configured
+		}
+	}
+	if e == nil {
+		e = c.adhoc.get(adhocKey{url: endpoint, guarded: httpClient != nil}, func() *Endpoint {
+			e := c.newEndpoint(EndpointConfig{URL: endpoint})
+			if httpClient != nil {
+				e.httpClient = httpClient
+			}
+			return e
+		})
+	}
+	return &Client{
+		endpoints:   []*Endpoint{e},
+		adhoc:       c.adhoc,
+		flights:     c.flights,
+		httpClient:  c.httpClient,
+		auth:        c.auth,
+		timeout:     c.timeout,
+		policy:      c.policy,
+		breaker:     c.breaker,
+		concurrency: c.concurrency,
+		rateLimit:   c.rateLimit,
+		cassette:    c.cassette,
+	}
+}
+
+// withPolicy returns a client for the endpoints of c that attempts every
+// method as policy says, for requests the catalog policy does not fit. It
+// does not cache.
+func (c *Client) withPolicy(policy RetryPolicy) *Client {
+	return &Client{
+		endpoints:   c.endpoints,
+		adhoc:       c.adhoc,
+		flights:     c.flights,
+		httpClient:  c.httpClient,
+		auth:        c.auth,
+		policy:      func(string) RetryPolicy { return policy },
+		breaker:     c.breaker,
+		concurrency: c.concurrency,
+		rateLimit:   c.rateLimit,
+		cassette:    c.cassette,
+	}
+}
+
+// policyOf returns the retry policy of method with the client timeout
+// applied.
+func (c *Client) policyOf(method string) RetryPolicy {
+	policy := c.policy(method)
+	if c.timeout > 0 {
+		policy.Timeout = c.timeout
+	}
+	return policy
+}
+
+// CallRaw sends a JSON-RPC request and returns the response body.
+// Each attempt is bounded by the method's timeout and failures are retried
+// according to its RetryPolicy. Cancelling ctx aborts the request in flight
+// and any further attempts. Results of methods with a cache mode may come
+// from the response cache. Identical requests in flight on the same
+// endpoints are sent once and their response shared.
+func (c *Client) CallRaw(ctx context.Context, method string, params []interface{}) ([]byte, error) {
+	policy := c.policyOf(method)
+
+	// 构建 JSON-RPC 请求体
+	request := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      c.nextID.Add(1),
+	}
+
+	key, cached := c.cacheKey(method, params)
+	if key != "" {
+		if result, ok := c.cache.get(key, method); ok {
+			return cachedResponse(request.ID, result)
+		}
+	}
+
+	// 将请求体编码为 JSON
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		log.Error("Error marshaling JSON request:", err)
+		return nil, err
+	}
+	flight, err := flightKey(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	body, shared, err := c.flights.do(ctx, c.endpointsKey()+" "+flight, func(ctx context.Context) ([]byte, error) {
+		metrics.Inc("rpc_calls_upstream_total", "method", method)
+		body, err := c.send(ctx, method, callCost(method, params), policy, requestBody)
+		if err == nil && key != "" {
+			if result, err := decodeResponse(body); err == nil {
+				c.storeResult(ctx, key, cached, params, result)
+			}
+		}
+		return body, err
+	})
+	if shared {
+		metrics.Inc("rpc_calls_shared_total", "method", method)
+		log.Debug("RPC request shared with an identical one in flight", "method", method)
+		if err == nil {
+			body = withResponseID(body, request.ID)
+		}
+	}
+	return body, err
+}
+
+// endpointsKey identifies the endpoints c sends to, so that only requests
+// bound for the same endpoints are coalesced. Endpoints are told apart by
+// identity, as WithEndpoint may make two for one URL.
+func (c *Client) endpointsKey() string {
+	var b bytes.Buffer
+	for _, e := range c.endpoints {
+		fmt.Fprintf(&b, "%p,", e)
+	}
+	return b.String()
+}
+
+// send posts requestBody, retrying failed attempts according to policy.
+// method names the request in logs and every attempt draws cost from the
+// rate limit of the endpoint it goes to.
+func (c *Client) send(ctx context.Context, method string, cost rateCost, policy RetryPolicy, requestBody []byte) ([]byte, error) {
+	// 记录请求开始
+	log.Debug("Starting RPC request", "method", method, "timeout", policy.Timeout, "attempts", policy.MaxAttempts, "req", string(requestBody))
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(policy.delay(attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		body, status, err := c.postAny(ctx, method, cost, requestBody, policy.Timeout)
+		if err == nil {
+			// 成功返回
+			log.Debug("RPC request successful", "method", method, "attempt", attempt)
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			log.Debug("RPC request cancelled", "method", method, "attempt", attempt, "error", ctx.Err())
+			return nil, ctx.Err()
+		}
+		lastErr = err
+		class := classifyError(err, status)
+		log.Warn("RPC request failed", "method", method, "attempt", attempt, "of", policy.MaxAttempts, "class", class, "error", err)
+		if !policy.retries(class) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("RPC request failed after %d attempts, last error: %w", policy.MaxAttempts, lastErr)
+}
+
+// postAny performs one attempt, trying the candidate endpoints in order
+// until one answers. Connection errors, timeouts and endpoints that reject
+// the request fast fail over; any other failure is returned as is.
+func (c *Client) postAny(ctx context.Context, method string, cost rateCost, requestBody []byte, timeout time.Duration) ([]byte, int, error) {
+	var (
+		body   []byte
+		status int
+		err    error
+	)
+	for i, e := range c.candidates() {
+		if i > 0 {
+			log.Warn("Failing over to next endpoint", "method", method, "endpoint", e.Name, "error", err)
+		}
+		body, status, err = c.postEndpoint(ctx, e, cost, requestBody, timeout)
+		if err == nil {
+			log.Debug("RPC request answered", "method", method, "endpoint", e.Name)
+			e.answered()
+			return body, status, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		var backoffErr *backoffError
+		if errors.As(err, &backoffErr) {
+			continue
+		}
+		if class := classifyError(err, status); class != RetryConnection && class != RetryTimeout {
+			break
+		}
+		if len(c.endpoints) > 1 {
+			// it is tried again after the breaker cooldown, or sooner if
+			// the health checker finds it healthy
+			cooldown := c.breaker.Cooldown
+			if cooldown <= 0 {
+				cooldown = defaultBreakerConfig.Cooldown
+			}
+			e.demote(fmt.Sprintf("request failed: %v", err), cooldown)
+		}
+	}
+	return body, status, err
+}
+
+// postEndpoint sends one request to e through its rate limit, concurrency
+// limiter and circuit breaker. It returns a *backoffError without
+// contacting e when any of them turns the request away.
+func (c *Client) postEndpoint(ctx context.Context, e *Endpoint, cost rateCost, requestBody []byte, timeout time.Duration) ([]byte, int, error) {
+	if err := e.rate.wait(ctx, cost, timeout); err != nil {
+		var backoffErr *backoffError
+		if errors.As(err, &backoffErr) {
+			e.recordRejected(backoffErr)
+		}
+		return nil, 0, err
+	}
+	if err := e.limiter.acquire(ctx); err != nil {
+		e.rate.refund(cost)
+		var backoffErr *backoffError
+		if errors.As(err, &backoffErr) {
+			e.recordRejected(backoffErr)
+		}
+		return nil, 0, err
+	}
+	admitted, err := e.breaker.allow()
+	if err != nil {
+		e.limiter.release(false)
+		e.rate.refund(cost)
+		e.recordRejected(err.(*backoffError))
+		return nil, 0, err
+	}
+	body, status, err := c.post(ctx, e, requestBody, timeout)
+	e.recordRequest(err)
+	if err != nil && ctx.Err() != nil {
+		// cancelled by the caller, which says nothing about the endpoint
+		e.breaker.release(admitted)
+		e.limiter.release(false)
+		return body, status, err
+	}
+	class := ""
+	if err != nil {
+		class = classifyError(err, status)
+	}
+	e.breaker.record(admitted, class != "")
+	e.limiter.release(class == RetryTimeout || class == RetryHTTP429 || status == http.StatusServiceUnavailable)
+	return body, status, err
+}
+
+// callEndpoint sends a single attempt of method to e and decodes the result,
+// bypassing failover, retries, the breaker and the limiter.
+func (c *Client) callEndpoint(ctx context.Context, e *Endpoint, method string, result interface{}) error {
+	requestBody, err := json.Marshal(JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  []interface{}{},
+		ID:      c.nextID.Add(1),
+	})
+	if err != nil {
+		return err
+	}
+	body, _, err := c.post(ctx, e, requestBody, c.policyOf(method).Timeout)
+	if err != nil {
+		return err
+	}
+	raw, err := decodeResponse(body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return &invalidResponseError{err}
+	}
+	return nil
+}
+
+// post performs a single attempt against e bounded by timeout and ctx, over
+// HTTP, the endpoint's websocket connection or its unix socket.
+// It returns the HTTP status code alongside any error so failures can be
+// classified. With a cassette the exchange is recorded, or replayed without
+// contacting e.
+func (c *Client) post(ctx context.Context, e *Endpoint, requestBody []byte, timeout time.Duration) ([]byte, int, error) {
+	if c.cassette != nil && c.cassette.Replaying() {
+		body, err := c.cassette.replay(e.Network, requestBody)
+		return body, 0, err
+	}
+	body, status, err := c.postWire(ctx, e, requestBody, timeout)
+	if err == nil && c.cassette != nil {
+		c.cassette.record(e.Network, requestBody, body)
+	}
+	return body, status, err
+}
+
+// postWire is post without the cassette.
+func (c *Client) postWire(ctx context.Context, e *Endpoint, requestBody []byte, timeout time.Duration) ([]byte, int, error) {
+	// 创建带超时的上下文
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if e.credentialsErr != nil {
+		return nil, 0, e.credentialsErr
+	}
+	if e.ws != nil {
+		body, err := e.ws.roundTrip(ctx, requestBody)
+		return body, 0, err
+	}
+	if e.ipc != "" {
+		body, err := ipcRoundTrip(ctx, e.ipc, requestBody)
+		return body, 0, err
+	}
+
+	// 创建HTTP请求
+	req, err := http.NewRequestWithContext(ctx, "POST", e.URL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		log.Error("Error creating HTTP request:", err)
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth, err := c.authorization(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	// 发送请求
+	httpClient := c.httpClient
+	if e.httpClient != nil {
+		httpClient = e.httpClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 检查HTTP状态码
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, httpStatusError(resp.StatusCode)
+	}
+	return body, resp.StatusCode, nil
+}
+
+// Call sends a JSON-RPC request and decodes its result into result, which
+// may be nil. An error answered by the node is returned as *RPCError.
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	body, err := c.CallRaw(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	raw, err := decodeResponse(body)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return &invalidResponseError{err}
+	}
+	return nil
+}
+
+// BatchCall is one request of a batch.
+type BatchCall struct {
+	Method string
+	Params []interface{}
+}
+
+// BatchResult is the outcome of one BatchCall. Err is an *RPCError when the
+// node answered the element with an error.
+type BatchResult struct {
+	Result json.RawMessage
+	Err    error
+}
+
+// CallBatch sends calls as one JSON-RPC 2.0 batch and returns their results
+// in the same order. Responses are matched by request ID; an element the node
+// did not answer gets an error of its own. The returned error is set only
+// when the batch as a whole failed. The batch is retried with the policy of
+// its first method and the longest timeout among its methods. Calls whose
+// results are cached are answered from the cache and left out of the batch.
+func (c *Client) CallBatch(ctx context.Context, calls []BatchCall) ([]BatchResult, error) {
+	results := make([]BatchResult, len(calls))
+	keys := make([]string, len(calls))
+	cached := make([]Method, len(calls))
+	var pending []BatchCall
+	var indexes []int
+	for i, call := range calls {
+		keys[i], cached[i] = c.cacheKey(call.Method, call.Params)
+		if keys[i] != "" {
+			if result, ok := c.cache.get(keys[i], call.Method); ok {
+				results[i].Result = result
+				continue
+			}
+		}
+		pending = append(pending, call)
+		indexes = append(indexes, i)
+	}
+	sent, err := c.callBatch(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	for j, r := range sent {
+		i := indexes[j]
+		results[i] = r
+		if keys[i] != "" && r.Err == nil {
+			c.storeResult(ctx, keys[i], cached[i], calls[i].Params, r.Result)
+		}
+	}
+	return results, nil
+}
+
+// callBatch sends calls as one batch, see CallBatch.
+func (c *Client) callBatch(ctx context.Context, calls []BatchCall) ([]BatchResult, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	policy := c.policyOf(calls[0].Method)
+	requests := make([]JSONRPCRequest, len(calls))
+	var cost rateCost
+	for i, call := range calls {
+		if t := c.policyOf(call.Method).Timeout; t > policy.Timeout {
+			policy.Timeout = t
+		}
+		callCost := callCost(call.Method, call.Params)
+		cost.calls += callCost.calls
+		cost.expensive += callCost.expensive
+		params := call.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		requests[i] = JSONRPCRequest{
+			JSONRPC: "2.0",
+			Method:  call.Method,
+			Params:  params,
+			ID:      c.nextID.Add(1),
+		}
+	}
+	requestBody, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.send(ctx, fmt.Sprintf("batch of %d", len(calls)), cost, policy, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		// the node rejected the batch as a whole
+		if _, err := decodeResponse(body); err != nil {
+			return nil, err
+		}
+		return nil, &invalidResponseError{fmt.Errorf("expected an array of responses")}
+	}
+	var responses []JSONRPCResponse
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return nil, &invalidResponseError{err}
+	}
+	byID := make(map[uint64]JSONRPCResponse, len(responses))
+	for _, resp := range responses {
+		byID[resp.ID] = resp
+	}
+
+	results := make([]BatchResult, len(calls))
+	for i, req := range requests {
+		resp, ok := byID[req.ID]
+		switch {
+		case !ok:
+			results[i].Err = &invalidResponseError{fmt.Errorf("no response for request %d (%s)", req.ID, req.Method)}
+		case resp.Error != nil:
+			results[i].Err = resp.Error
+		case len(resp.Result) == 0:
+			results[i].Result = json.RawMessage("null")
+		default:
+			results[i].Result = resp.Result
+		}
+	}
+	return results, nil
+}
+
+// StateRoot is the verbose result of qng_getStateRoot.
+type StateRoot struct {
+	Hash         string `json:"Hash"`
+	Order        uint64 `json:"Order"`
+	Height       uint64 `json:"Height"`
+	Valid        bool   `json:"Valid"`
+	EVMStateRoot string `json:"EVMStateRoot"`
+	EVMHeight    uint64 `json:"EVMHeight"`
+	EVMHead      string `json:"EVMHead"`
+	StateRoot    string `json:"StateRoot"`
+}
+
+// blockByOrderParams are the params of qng_getBlockByOrder for the block at
+// order, decoded with its transactions.
+func blockByOrderParams(order uint64) []interface{} {
+	return []interface{}{order, true}
+}
+
+// stateRootParams are the params of qng_getStateRoot for the block at
+// order, decoded.
+func stateRootParams(order uint64) []interface{} {
+	return []interface{}{order, true}
+}
+
+// GetBlockByOrder returns the block at order with its full transactions.
+// The built-in tools pass the node's result on as is instead; these typed
+// helpers are for Go callers.
+func (c *Client) GetBlockByOrder(ctx context.Context, order uint64) (*qjson.BlockVerboseResult, error) {
+	var block qjson.BlockVerboseResult
+	if err := c.Call(ctx, "qng_getBlockByOrder", blockByOrderParams(order), &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// GetBlockCount returns the number of blocks the node has ordered.
+func (c *Client) GetBlockCount(ctx context.Context) (uint64, error) {
+	var count uint64
+	if err := c.Call(ctx, "qng_getBlockCount", []interface{}{}, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetStateRoot returns the state roots of the block at order.
+func (c *Client) GetStateRoot(ctx context.Context, order uint64) (*StateRoot, error) {
+	var root StateRoot
+	if err := c.Call(ctx, "qng_getStateRoot", stateRootParams(order), &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientRequestIDs(t *testing.T) {
+	var mu sync.Mutex
+	ids := make(map[uint64]bool)
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		ids[req.ID] = true
+		auth = r.Header.Get("Authorization")
+		mu.Unlock()
+		json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("7")})
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, WithAuthorization("Bearer secret"))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		// distinct params, identical requests in flight would be coalesced
+		go func(i int) {
+			defer wg.Done()
+			if _, err := c.CallRaw(context.Background(), "qng_getBlockCount", []interface{}{i}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(ids) != 20 {
+		t.Errorf("Expected 20 distinct request IDs, got %d", len(ids))
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Expected the Authorization header to be sent, got %q", auth)
+	}
+}
+
+func TestClientTypedHelpers(t *testing.T) {
+	node := newFakeNode(t, func(method string, params []interface{}) (interface{}, *RPCError) {
+		switch method {
+		case "qng_getBlockByOrder":
+			if params[0] != float64(12) {
+				return nil, &RPCError{Code: rpcCodeBlockNotFound, Message: "Block Not Found error"}
+			}
+			return map[string]interface{}{"hash": "ab", "order": 12, "height": 10, "confirmations": 3}, nil
+		case "qng_getStateRoot":
+			return map[string]interface{}{"Hash": "ab", "Order": 12, "Valid": true, "StateRoot": "cd"}, nil
+		case "qng_getBlockCount":
+			return 13, nil
+		}
+		return nil, &RPCError{Code: rpcCodeMethodNotFound, Message: "Method not found"}
+	})
+	c := NewClient(node.URL)
+	ctx := context.Background()
+
+	block, err := c.GetBlockByOrder(ctx, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash != "ab" || block.Order != 12 || block.Height != 10 || block.Confirmations != 3 {
+		t.Errorf("Unexpected block: %+v", block)
+	}
+	var rpcErr *RPCError
+	if _, err := c.GetBlockByOrder(ctx, 99); !errors.As(err, &rpcErr) || rpcErr.Code != rpcCodeBlockNotFound {
+		t.Errorf("Expected a block not found RPC error, got %v", err)
+	}
+
+	root, err := c.GetStateRoot(ctx, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Hash != "ab" || !root.Valid || root.StateRoot != "cd" {
+		t.Errorf("Unexpected state root: %+v", root)
+	}
+
+	count, err := c.GetBlockCount(ctx)
+	if err != nil || count != 13 {
+		t.Errorf("Expected block count 13, got %d, %v", count, err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	once := func(string) RetryPolicy {
+		return RetryPolicy{Timeout: time.Minute, MaxAttempts: 1}
+	}
+	c := NewClient(srv.URL, WithTimeout(20*time.Millisecond), WithRetryPolicy(once))
+	start := time.Now()
+	_, err := c.CallRaw(context.Background(), "qng_getNodeInfo", nil)
+	if err == nil || classifyError(err, 0) != RetryTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the client timeout to apply, took %v", elapsed)
+	}
+}
+
+func TestCallBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []JSONRPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// answer out of order, fail the second and drop the last element
+		resps := []JSONRPCResponse{
+			{JSONRPC: "2.0", ID: reqs[2].ID, Result: json.RawMessage(`"c"`)},
+			{JSONRPC: "2.0", ID: reqs[1].ID, Error: &RPCError{Code: rpcCodeInvalidParams, Message: "Invalid parameters"}},
+			{JSONRPC: "2.0", ID: reqs[0].ID, Result: json.RawMessage(`"a"`)},
+		}
+		json.NewEncoder(w).Encode(resps)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	results, err := c.CallBatch(context.Background(), []BatchCall{
+		{Method: "qng_a"}, {Method: "qng_b"}, {Method: "qng_c"}, {Method: "qng_d"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(results[0].Result) != `"a"` || string(results[2].Result) != `"c"` {
+		t.Errorf("Expected results to be matched by ID, got %s and %s", results[0].Result, results[2].Result)
+	}
+	var rpcErr *RPCError
+	if !errors.As(results[1].Err, &rpcErr) || rpcErr.Code != rpcCodeInvalidParams {
+		t.Errorf("Expected the second element to fail, got %v", results[1].Err)
+	}
+	var respErr *invalidResponseError
+	if !errors.As(results[3].Err, &respErr) {
+		t.Errorf("Expected a missing response to be reported, got %v", results[3].Err)
+	}
+
+	if _, err := c.CallBatch(context.Background(), nil); err != nil {
+		t.Errorf("Expected an empty batch to succeed, got %v", err)
+	}
+}
+
+func TestWithEndpointBounded(t *testing.T) {
+	c := NewClient("http://127.0.0.1:1/")
+	first := c.WithEndpoint("http://node-0.example.com/").endpoints[0]
+	for i := 1; i < 2*maxAdhocEndpoints; i++ {
+		c.WithEndpoint(fmt.Sprintf("http://node-%d.example.com/", i))
+		// node-0 stays in use
+		if e := c.WithEndpoint("http://node-0.example.com/").endpoints[0]; e != first {
+			t.Fatal("Expected a recently used endpoint to be kept")
+		}
+	}
+	if n := c.adhoc.lru.Len(); n != maxAdhocEndpoints {
+		t.Errorf("Expected %d ad-hoc endpoints to be kept, got %d", maxAdhocEndpoints, n)
+	}
+	if c.WithEndpoint("http://127.0.0.1:1/").endpoints[0] != c.endpoints[0] || c.adhoc.lru.Len() != maxAdhocEndpoints {
+		t.Error("Expected a configured endpoint not to be kept as ad-hoc")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// JSON-RPC error codes returned by QNG nodes, see qng rpc/client/cmds.
+const (
+	rpcCodeParse          = -32700
+	rpcCodeDecodeHex      = -32701
+	rpcCodeInvalidRequest = -32600
+	rpcCodeMethodNotFound = -32601
+	rpcCodeInvalidParams  = -32602
+	rpcCodeInternal       = -32603
+	rpcCodeDatabase       = -32001
+	rpcCodeBlockNotFound  = -32002
+	rpcCodeInvalidNode    = -32003
+)
+
+// rpcCodeHints tells the model how to react to a well-known error code.
+var rpcCodeHints = map[int]string{
+	rpcCodeParse:          "The node could not parse the request. Retrying with the same arguments will not help.",
+	rpcCodeDecodeHex:      "An argument is not valid hex. Hashes are 64 hex characters, optionally prefixed with 0x.",
+	rpcCodeInvalidRequest: "The node rejected the request as malformed. Retrying with the same arguments will not help.",
+	rpcCodeMethodNotFound: "The node does not serve this method. Its RPC module may be disabled or the node may be too old; use another tool.",
+	rpcCodeInvalidParams:  "The node rejected the arguments. Check them against the tool schema and call again.",
+	rpcCodeInternal:       "The node failed to process the request. Check the arguments, or retry later.",
+	rpcCodeDatabase:       "The node's database returned an error. The node may be starting or syncing; retry later.",
+	rpcCodeBlockNotFound:  "Block not found. Check the hash or order; qng_get_block_count shows how far the node has synced.",
+	rpcCodeInvalidNode:    "The node is not in a state to serve this request, for example because it is not synced. Retry later.",
+}
+
+// rpcMessageHints match the message of errors that carry a generic code.
+var rpcMessageHints = []struct {
+	keyword string
+	hint    string
+}{
+	{"not synced", "Node not synced. It is still catching up with the network, so recent data may be missing; check is_current and retry later."},
+	{"not current", "Node not synced. It is still catching up with the network, so recent data may be missing; check is_current and retry later."},
+	{"initial download", "Node not synced. It is still catching up with the network, so recent data may be missing; check is_current and retry later."},
+	{"not found", "The requested object was not found. Check the hash, order or id and call again."},
+	{"no such", "The requested object was not found. Check the hash, order or id and call again."},
+	{"not connected", "The node has no peers. Results may be stale until it reconnects."},
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Hint returns advice for a model that received e, or "" if there is none.
+func (e *RPCError) Hint() string {
+	if hint, ok := rpcCodeHints[e.Code]; ok && e.Code != rpcCodeInternal {
+		return hint
+	}
+	msg := strings.ToLower(e.Message)
+	for _, h := range rpcMessageHints {
+		if strings.Contains(msg, h.keyword) {
+			return h.hint
+		}
+	}
+	return rpcCodeHints[e.Code]
+}
+
+// invalidResponseError is returned for a body that is not a JSON-RPC
+// response.
+type invalidResponseError struct {
+	err error
+}
+
+func (e *invalidResponseError) Error() string {
+	return fmt.Sprintf("invalid JSON-RPC response: %v", e.err)
+}
+
+func (e *invalidResponseError) Unwrap() error {
+	return e.err
+}
+
+// decodeResponse extracts the result of a JSON-RPC response body. An error
+// sent by the node is returned as *RPCError.
+func decodeResponse(body []byte) (json.RawMessage, error) {
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, &invalidResponseError{err}
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	if len(resp.Result) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	return resp.Result, nil
+}
+
+// rpcToolResult turns the response body of method into a tool result: the
+// decoded result on success, or an error result the model can act on.
+func rpcToolResult(method string, body []byte) *mcp.CallToolResult {
+	result, err := decodeResponse(body)
+	if err != nil {
+		return asToolError(method, err).Result()
+	}
+	return mcp.NewToolResultText(string(result))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RPCURLPolicy decides which nodes the rpc_url argument of a tool may
+// point at. The configured endpoints can always be used, by URL or by name.
+// Anything else must be an alias or be allowlisted, and must not resolve to
+// a loopback, private, link-local or metadata address unless AllowPrivate
+// is set. Without the policy rpc_url would let any MCP client make the
+// server send requests into its network.
+type RPCURLPolicy struct {
+	// Aliases maps names that may be passed as rpc_url to node URLs chosen
+	// by the operator. Alias targets are trusted like configured endpoints.
+	Aliases map[string]string
+	// Allowed lists URLs and hosts ("host" or "host:port") that may be
+	// passed as rpc_url.
+	Allowed []string
+	// AllowPrivate permits allowlisted URLs on private addresses.
+	AllowPrivate bool
+}
+
+// rpcURLDescription describes the rpc_url argument of the built-in tools.
+const rpcURLDescription = "QNG node to query (optional). Omit to use the configured node. Otherwise the name of a configured endpoint or alias as listed by qng_endpoint_status, or an http(s) URL the server allows. Example: http://127.0.0.1:8545/"
+
+// rpcURLPolicy is the policy set with -rpc-allow and -rpc-allow-private.
+var rpcURLPolicy RPCURLPolicy
+
+// rpcURLFlags defines the -rpc-allow and -rpc-allow-private flags on fs.
+// The returned function sets rpcURLPolicy from them once fs is parsed.
+func rpcURLFlags(fs *flag.FlagSet) func() error {
+	allow := fs.String("rpc-allow", "", "Comma separated nodes the rpc_url tool argument may use besides the configured ones: URLs, hosts or name=url aliases")
+	allowPrivate := fs.Bool("rpc-allow-private", false, "Let rpc_url reach allowed nodes on loopback, private, link-local and metadata addresses")
+	return func() error {
+		policy, err := ParseRPCURLPolicy(*allow, *allowPrivate)
+		if err != nil {
+			return err
+		}
+		rpcURLPolicy = policy
+		return nil
+	}
+}
+
+// ParseRPCURLPolicy parses a comma separated allowlist. An entry of the form
+// name=url defines an alias; any other entry is an allowed URL or host.
+func ParseRPCURLPolicy(list string, allowPrivate bool) (RPCURLPolicy, error) {
+	policy := RPCURLPolicy{AllowPrivate: allowPrivate}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if name, target, ok := strings.Cut(entry, "="); ok {
+			name, target = strings.TrimSpace(name), strings.TrimSpace(target)
+			if _, err := ParseEndpointList(target); err != nil || name == "" {
+				return RPCURLPolicy{}, fmt.Errorf("invalid alias %q, expected name=url", entry)
+			}
+			if policy.Aliases == nil {
+				policy.Aliases = make(map[string]string)
+			}
+			policy.Aliases[name] = target
+			continue
+		}
+		if strings.Contains(entry, "://") {
+			u, err := url.Parse(entry)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return RPCURLPolicy{}, fmt.Errorf("invalid allowed URL %q, expected http:// or https://", entry)
+			}
+		}
+		policy.Allowed = append(policy.Allowed, entry)
+	}
+	return policy, nil
+}
+
+// allows reports whether the caller supplied URL u is allowlisted.
+func (p RPCURLPolicy) allows(u *url.URL) bool {
+	for _, a := range p.Allowed {
+		if strings.Contains(a, "://") {
+			if strings.TrimSuffix(a, "/") == strings.TrimSuffix(u.String(), "/") {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(a, u.Host) || strings.EqualFold(a, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedAddressError is returned when a caller supplied rpc_url resolves
+// to an address the policy does not allow.
+type blockedAddressError struct {
+	IP net.IP
+}
+
+func (e *blockedAddressError) Error() string {
+	return fmt.Sprintf("address %s is private, loopback, link-local or a metadata service and not allowed for rpc_url", e.IP)
+}
+
+// blockedNets are the ranges caller supplied URLs may not reach besides
+// the loopback, private, link-local and unspecified ones net.IP reports.
+var blockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",         // "this" network
+		"100.64.0.0/10",     // carrier-grade NAT
+		"192.0.0.0/24",      // IETF protocol assignments
+		"198.18.0.0/15",     // benchmarking
+		"fd00:ec2::254/128", // AWS metadata over IPv6
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// checkIP returns a *blockedAddressError if ip may not be reached through a
+// caller supplied URL.
+func checkIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return &blockedAddressError{IP: ip}
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return &blockedAddressError{IP: ip}
+		}
+	}
+	return nil
+}
+
+// guardedHTTPClient returns an HTTP client that refuses to connect to
+// blocked addresses. The check runs on the resolved address of every
+// connection, so DNS names that point inside the network are caught too.
+// Redirects are not followed.
+func guardedHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("unexpected address %q", address)
+			}
+			return checkIP(ip)
+		},
+	}
+	transport := newHTTPClient().Transport.(*http.Transport)
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// rpcURLNames lists what rpc_url accepts, for error messages.
+func (s *MCPServer) rpcURLNames() string {
+	var names []string
+	for _, e := range s.rpc.endpoints {
+		names = append(names, e.Name)
+	}
+	for name := range s.urlPolicy.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// allowedClient returns a client for a node URL that is neither configured
+// nor an alias, if the policy allows it.
+func (s *MCPServer) allowedClient(raw string) (*Client, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, s.rpcURLRejected(raw, "expected an endpoint name or an http(s) URL")
+	}
+	if !s.urlPolicy.allows(u) {
+		return nil, s.rpcURLRejected(raw, "it is not an allowed endpoint")
+	}
+	if s.urlPolicy.AllowPrivate {
+		return s.rpc.WithEndpoint(raw), nil
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if err := checkIP(ip); err != nil {
+			return nil, s.rpcURLRejected(raw, err.Error())
+		}
+	}
+	return s.rpc.withEndpoint(raw, s.guarded), nil
+}
+
+// rpcURLRejected reports an rpc_url argument that may not be used.
+func (s *MCPServer) rpcURLRejected(raw, reason string) *ToolError {
+	err := invalidArgument("rpc_url", "rpc_url %q cannot be used: %s", redactURL(raw), reason)
+	err.Hint = "Omit rpc_url to query the configured QNG node, or pass one of: " + s.rpcURLNames() + "."
+	return err
+}
+
+// isBlockedAddress reports whether err was caused by a blocked address.
+func isBlockedAddress(err error) bool {
+	var blocked *blockedAddressError
+	return errors.As(err, &blocked)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseRPCURLPolicy(t *testing.T) {
+	policy, err := ParseRPCURLPolicy("archive=https://archive.example.com/, node.example.com, http://10.0.0.5:8545/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Aliases["archive"] != "https://archive.example.com/" || len(policy.Allowed) != 2 || !policy.AllowPrivate {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+	for _, bad := range []string{"=http://x/", "archive=", "ftp://node.example.com/"} {
+		if _, err := ParseRPCURLPolicy(bad, false); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRPCURLFlags(t *testing.T) {
+	saved := rpcURLPolicy
+	defer func() { rpcURLPolicy = saved }()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	apply := rpcURLFlags(fs)
+	if err := fs.Parse([]string{"-rpc-allow", "mirror=http://10.0.0.5:8545/,node.example.com", "-rpc-allow-private"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMCPServer(NewClient("http://127.0.0.1:8545/"))
+	if s.urlPolicy.Aliases["mirror"] != "http://10.0.0.5:8545/" || len(s.urlPolicy.Allowed) != 1 || !s.urlPolicy.AllowPrivate {
+		t.Errorf("Expected the flags to reach the server, got %+v", s.urlPolicy)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	apply = rpcURLFlags(fs)
+	fs.Parse([]string{"-rpc-allow", "=http://x/"})
+	if err := apply(); err == nil {
+		t.Error("Expected an invalid -rpc-allow to be rejected")
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	for ip, blocked := range map[string]bool{
+		"169.254.169.254":  true,
+		"fd00:ec2::254":    true,
+		"127.0.0.1":        true,
+		"::ffff:127.0.0.1": true,
+		"10.1.2.3":         true,
+		"192.168.1.1":      true,
+		"100.64.0.1":       true,
+		"0.0.0.0":          true,
+		"::1":              true,
+		"8.8.8.8":          false,
+		"2001:4860::8888":  false,
+	} {
+		if err := checkIP(net.ParseIP(ip)); (err != nil) != blocked {
+			t.Errorf("%s: expected blocked %v, got %v", ip, blocked, err)
+		}
+	}
+}
+
+func TestRPCURLArgument(t *testing.T) {
+	var calls int32
+	node := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			var req JSONRPCRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("7")})
+		}))
+	}
+	configured, other := node(), node()
+	defer configured.Close()
+	defer other.Close()
+
+	s := NewMCPServer(NewClient(configured.URL))
+	s.urlPolicy = RPCURLPolicy{Aliases: map[string]string{"other": other.URL}}
+	configuredName := s.rpc.endpoints[0].Name
+
+	for _, arg := range []interface{}{nil, "", configured.URL, configuredName, "other"} {
+		rpc, err := s.clientArg(map[string]interface{}{"rpc_url": arg})
+		if err != nil {
+			t.Errorf("%v: expected to be allowed, got %v", arg, err)
+			continue
+		}
+		if count, err := rpc.GetBlockCount(context.Background()); err != nil || count != 7 {
+			t.Errorf("%v: expected block count 7, got %d, %v", arg, count, err)
+		}
+	}
+	if rpc, _ := s.clientArg(map[string]interface{}{}); rpc != s.rpc {
+		t.Error("Expected the configured node without rpc_url")
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(other.URL, "http://"))
+	for _, arg := range []interface{}{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://node.example.com:8545/",
+		"file:///etc/passwd",
+		other.URL, // allowlisted below only by host
+		42,
+	} {
+		_, err := s.clientArg(map[string]interface{}{"rpc_url": arg})
+		if toolErr := asToolError("qng_getBlockCount", err); toolErr.Kind != ErrorInvalidArgument || toolErr.Argument != "rpc_url" {
+			t.Errorf("%v: expected an invalid rpc_url, got %+v", arg, toolErr)
+		}
+	}
+	if err := s.rpcURLRejected("http://x/", "no"); !strings.Contains(err.Hint, configuredName) || !strings.Contains(err.Hint, "other") {
+		t.Errorf("Expected the hint to list the allowed names, got %q", err.Hint)
+	}
+
+	// allowlisted hosts that resolve to a private address are refused when
+	// connecting, too
+	s.urlPolicy = RPCURLPolicy{Allowed: []string{"localhost"}}
+	rpc, err := s.clientArg(map[string]interface{}{"rpc_url": "http://localhost:" + port + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rpc.GetBlockCount(context.Background())
+	if toolErr := asToolError("qng_getBlockCount", err); toolErr.Kind != ErrorInvalidArgument || toolErr.Argument != "rpc_url" || toolErr.Retryable {
+		t.Errorf("Expected the private address to be refused, got %+v", toolErr)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("Expected refused URLs not to reach a node, got %d calls", n)
+	}
+
+	s.urlPolicy.AllowPrivate = true
+	rpc, err = s.clientArg(map[string]interface{}{"rpc_url": "http://localhost:" + port + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := rpc.GetBlockCount(context.Background()); err != nil || count != 7 {
+		t.Errorf("Expected private addresses to be reachable when allowed, got %d, %v", count, err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Kinds of tool errors. The kind tells the model whether changing the call
+// can help.
+const (
+	// ErrorInvalidArgument means the arguments must be corrected.
+	ErrorInvalidArgument = "invalid_argument"
+	// ErrorRPC means the node answered with a JSON-RPC error.
+	ErrorRPC = "rpc_error"
+	// ErrorUpstream means the node could not be reached or did not answer.
+	ErrorUpstream = "upstream_error"
+	// ErrorInvalidResponse means the node's answer could not be decoded.
+	ErrorInvalidResponse = "invalid_response"
+	// ErrorCancelled means the call was abandoned by the client.
+	ErrorCancelled = "cancelled"
+	// ErrorUnavailable means the server refused to contact a failing or
+	// overloaded node; the call should be retried after a pause.
+	ErrorUnavailable = "unavailable"
+)
+
+// ToolError is a failure the model can recover from. It is returned to the
+// client as a tool result with IsError set, its fields encoded as JSON.
+// Faults of the server itself are returned as Go errors instead and become
+// protocol errors.
+type ToolError struct {
+	Kind string `json:"kind"`
+	// Method is the node RPC method the tool called, if any.
+	Method string `json:"method,omitempty"`
+	// Argument names the tool argument that was rejected.
+	Argument string `json:"argument,omitempty"`
+	// Code and Data are copied from a JSON-RPC error.
+	Code    int         `json:"code,omitempty"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+	// Class is the retry class of an upstream failure, see classifyError.
+	Class string `json:"class,omitempty"`
+	Hint  string `json:"hint,omitempty"`
+	// Retryable reports whether the same call may succeed later.
+	Retryable bool `json:"retryable"`
+	// RetryAfter is the number of seconds to wait before calling again.
+	RetryAfter float64 `json:"retry_after_seconds,omitempty"`
+}
+
+func (e *ToolError) Error() string {
+	if e.Method != "" {
+		return fmt.Sprintf("%s: %s", e.Method, e.Message)
+	}
+	return e.Message
+}
+
+// Result encodes e as an error tool result.
+func (e *ToolError) Result() *mcp.CallToolResult {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return mcp.NewToolResultError(e.Error())
+	}
+	return mcp.NewToolResultError(string(data))
+}
+
+// invalidArgument reports a tool argument the model must correct.
+func invalidArgument(name, format string, args ...interface{}) *ToolError {
+	return &ToolError{
+		Kind:     ErrorInvalidArgument,
+		Argument: name,
+		Message:  fmt.Sprintf(format, args...),
+		Hint:     "Correct the argument as described and call the tool again.",
+	}
+}
+
+// upstreamHints explains a transport failure by its retry class.
+var upstreamHints = map[string]string{
+	RetryTimeout:    "The node did not answer in time. Retry later, or ask for less data.",
+	RetryConnection: "The node could not be reached. It may be down or restarting; retry later.",
+	RetryHTTP5xx:    "The node or a proxy in front of it failed. Retry later.",
+	RetryHTTP429:    "The node is rate limiting requests. Wait before calling again.",
+}
+
+// backoffHints explains why a request was refused without contacting the
+// node.
+var backoffHints = map[string]string{
+	"circuit_open": "The node failed repeatedly and is given time to recover. Back off: do not call QNG tools again before retry_after_seconds has passed.",
+	"queue_full":   "Too many requests are waiting for the node. Back off: make fewer calls at once and retry after retry_after_seconds.",
+	"rate_limited": "The request rate allowed toward the node is used up. Back off: retry after retry_after_seconds and make fewer calls.",
+	"expensive_rate_limited": "Calls of expensive methods such as state roots, address transactions and blocks with full transactions are limited. " +
+		"Retry after retry_after_seconds, or ask for less, for example blocks without full transactions.",
+}
+
+// asToolError describes err, returned while calling method, as a ToolError.
+func asToolError(method string, err error) *ToolError {
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) {
+		if toolErr.Method == "" {
+			toolErr.Method = method
+		}
+		return toolErr
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return &ToolError{
+			Kind:      ErrorRPC,
+			Method:    method,
+			Code:      rpcErr.Code,
+			Message:   rpcErr.Message,
+			Data:      rpcErr.Data,
+			Hint:      rpcErr.Hint(),
+			Retryable: rpcErr.Code == rpcCodeDatabase || rpcErr.Code == rpcCodeInvalidNode,
+		}
+	}
+	var backoffErr *backoffError
+	if errors.As(err, &backoffErr) {
+		return &ToolError{
+			Kind:       ErrorUnavailable,
+			Method:     method,
+			Message:    err.Error(),
+			Class:      backoffErr.Reason,
+			Hint:       backoffHints[backoffErr.Reason],
+			Retryable:  true,
+			RetryAfter: math.Ceil(backoffErr.RetryAfter.Seconds()),
+		}
+	}
+	var blocked *blockedAddressError
+	if errors.As(err, &blocked) {
+		toolErr := invalidArgument("rpc_url", "%v", blocked)
+		toolErr.Method = method
+		toolErr.Hint = "Omit rpc_url to query the configured QNG node, or pass the name of a configured endpoint."
+		return toolErr
+	}
+	if errors.Is(err, context.Canceled) {
+		return &ToolError{Kind: ErrorCancelled, Method: method, Message: "the call was cancelled"}
+	}
+	if isCassetteMiss(err) {
+		return &ToolError{
+			Kind:    ErrorUpstream,
+			Method:  method,
+			Message: err.Error(),
+			Hint:    "The server replays recorded node traffic and this request was not recorded. Record the cassette again with --record, making this call.",
+		}
+	}
+	var respErr *invalidResponseError
+	if errors.As(err, &respErr) {
+		return &ToolError{
+			Kind:    ErrorInvalidResponse,
+			Method:  method,
+			Message: err.Error(),
+			Hint:    "The node sent a response that is not JSON-RPC. Check that the RPC endpoint points at a QNG node.",
+		}
+	}
+	status := 0
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		status = int(statusErr)
+	}
+	class := classifyError(err, status)
+	return &ToolError{
+		Kind:      ErrorUpstream,
+		Method:    method,
+		Message:   err.Error(),
+		Class:     class,
+		Hint:      upstreamHints[class],
+		Retryable: class != "",
+	}
+}
+
+// toolErrorResult returns err as an error tool result.
+func toolErrorResult(method string, err error) (*mcp.CallToolResult, error) {
+	return asToolError(method, err).Result(), nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Method categories. Each category is a toolset that can be enabled on its
+// own with --toolsets.
+const (
+	CategoryBlock       = "block"
+	CategoryTransaction = "transaction"
+	CategoryNetwork     = "network"
+	CategoryNode        = "node"
+	CategoryMining      = "mining"
+	CategoryChain       = "chain"
+)
+
+// Categories lists every category in the order they are documented.
+var Categories = []string{
+	CategoryBlock,
+	CategoryTransaction,
+	CategoryNetwork,
+	CategoryNode,
+	CategoryMining,
+	CategoryChain,
+}
+
+// toolsetAll enables every toolset, including uncategorised methods.
+const toolsetAll = "all"
+
+// enabledToolsets is the set selected with --toolsets; nil enables all.
+var enabledToolsets map[string]bool
+
+func validCategory(c string) bool {
+	for _, v := range Categories {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseToolsets parses a comma separated toolset list such as "block,chain".
+// An empty list or "all" returns nil, which enables every toolset.
+func ParseToolsets(list string) (map[string]bool, error) {
+	sets := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "":
+			continue
+		case name == toolsetAll:
+			return nil, nil
+		case !validCategory(name):
+			return nil, fmt.Errorf("unknown toolset %q, expected one of %s", name, strings.Join(Categories, ", "))
+		}
+		sets[name] = true
+	}
+	if len(sets) == 0 {
+		return nil, nil
+	}
+	return sets, nil
+}
+
+// sessionToolset holds the toolsets one session enabled with
+// qng_enable_toolset.
+type sessionToolset struct {
+	// sets holds the enabled toolsets, toolsetAll if all of them.
+	sets map[string]bool
+	// shared is set for a session that cannot carry tools of its own, as
+	// the stdio and SSE sessions of mcp-go cannot. Its tools are registered
+	// for every session, and filterTools and gateTool keep them from the
+	// others.
+	shared bool
+	// tools lists the tools added with AddSessionTools otherwise.
+	tools []string
+}
+
+// enables reports whether ts enabled the toolset category; ts may be nil.
+func (ts *sessionToolset) enables(category string) bool {
+	return ts != nil && (ts.sets[toolsetAll] || ts.sets[category])
+}
+
+// sessionEnabled reports whether tools of category are enabled for the
+// session id. It must be called with toolsMu held.
+func (s *MCPServer) sessionEnabled(id, category string) bool {
+	return s.toolsetEnabled(category) || s.sessionToolsets[id].enables(category)
+}
+
+// sharedEnabled reports whether tools of category are registered for every
+// session. It must be called with toolsMu held.
+func (s *MCPServer) sharedEnabled(category string) bool {
+	if s.toolsetEnabled(category) {
+		return true
+	}
+	for _, ts := range s.sessionToolsets {
+		if ts.shared && ts.enables(category) {
+			return true
+		}
+	}
+	return false
+}
+
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// filterTools hides from a session the tools of toolsets it did not enable.
+func (s *MCPServer) filterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	id := sessionID(ctx)
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	visible := make([]mcp.Tool, 0, len(tools))
+	for _, t := range tools {
+		if category, ok := s.categories[t.Name]; !ok || s.sessionEnabled(id, category) {
+			visible = append(visible, t)
+		}
+	}
+	return visible
+}
+
+// gateTool wraps the handler of a tool registered for every session on
+// behalf of a session that enabled its toolset, refusing calls of the other
+// sessions.
+func (s *MCPServer) gateTool(name, category string, next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		s.toolsMu.Lock()
+		enabled := s.sessionEnabled(sessionID(ctx), category)
+		s.toolsMu.Unlock()
+		if !enabled {
+			return (&ToolError{
+				Kind:    ErrorInvalidArgument,
+				Message: fmt.Sprintf("tool %s belongs to the %s toolset, which is not enabled", name, category),
+				Hint:    fmt.Sprintf("Call qng_enable_toolset with toolset %q first.", category),
+			}).Result(), nil
+		}
+		return next(ctx, request)
+	}
+}
+
+// syncSessionTools sets the tools the session id carries of its own to
+// those of the toolsets it enabled. It must be called with toolsMu held.
+func (s *MCPServer) syncSessionTools(id string, ts *sessionToolset) error {
+	tools := s.toolsFor(func(category string) bool {
+		return !s.toolsetEnabled(category) && ts.enables(category)
+	})
+	names := make([]string, 0, len(tools))
+	current := make(map[string]struct{}, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Tool.Name)
+		current[t.Tool.Name] = struct{}{}
+	}
+	var stale []string
+	for _, name := range ts.tools {
+		if _, ok := current[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		if err := s.server.DeleteSessionTools(id, stale...); err != nil {
+			return err
+		}
+	}
+	if len(tools) > 0 {
+		if err := s.server.AddSessionTools(id, tools...); err != nil {
+			return err
+		}
+	}
+	ts.tools = names
+	return nil
+}
+
+// refreshSessionTools re-adds the tools of the sessions carrying their own,
+// after a catalog reload. It must be called with toolsMu held.
+func (s *MCPServer) refreshSessionTools() {
+	for id, ts := range s.sessionToolsets {
+		if ts.shared {
+			continue
+		}
+		if err := s.syncSessionTools(id, ts); err != nil {
+			log.Warn("Failed to update the tools of a session", "session", id, "error", err)
+		}
+	}
+}
+
+// onUnregisterSession forgets the toolsets of a client that disconnected.
+func (s *MCPServer) onUnregisterSession(ctx context.Context, session server.ClientSession) {
+	s.toolsMu.Lock()
+	ts := s.sessionToolsets[session.SessionID()]
+	delete(s.sessionToolsets, session.SessionID())
+	s.toolsMu.Unlock()
+	if ts != nil && ts.shared {
+		// drop the tools no other session needs
+		s.registerTools()
+	}
+}
+
+// handleEnableToolset handles the qng_enable_toolset tool request. The
+// toolset is enabled for the calling session only.
+func (s *MCPServer) handleEnableToolset(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	name, _ := request.Params.Arguments["toolset"].(string)
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name != toolsetAll && !validCategory(name) {
+		return invalidArgument("toolset", "unknown toolset %q, expected one of %s or %s", name, strings.Join(Categories, ", "), toolsetAll).Result(), nil
+	}
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return nil, errors.New("qng_enable_toolset needs a client session")
+	}
+	id := session.SessionID()
+
+	s.toolsMu.Lock()
+	ts := s.sessionToolsets[id]
+	if ts == nil {
+		_, own := session.(server.SessionWithTools)
+		ts = &sessionToolset{sets: make(map[string]bool), shared: !own}
+		s.sessionToolsets[id] = ts
+	}
+	added := len(s.toolsFor(func(category string) bool {
+		return !s.sessionEnabled(id, category) && (name == toolsetAll || category == name)
+	}))
+	ts.sets[name] = true
+	var enabled []string
+	if s.toolsets == nil || ts.sets[toolsetAll] {
+		enabled = []string{toolsetAll}
+	} else {
+		for k := range s.toolsets {
+			enabled = append(enabled, k)
+		}
+		for k := range ts.sets {
+			if !s.toolsets[k] {
+				enabled = append(enabled, k)
+			}
+		}
+		sort.Strings(enabled)
+	}
+	var err error
+	if !ts.shared {
+		// adding session tools sends tools/list_changed to the session
+		err = s.syncSessionTools(id, ts)
+	}
+	shared := ts.shared
+	s.toolsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		// registering the tools sends tools/list_changed to the clients
+		s.registerTools()
+	}
+
+	log.Info("Enabled toolset", "session", id, "toolset", name, "enabled", strings.Join(enabled, ","), "added", added)
+	return mcp.NewToolResultText(fmt.Sprintf("Toolset %s enabled, %d tools added. Enabled toolsets: %s.", name, added, strings.Join(enabled, ", "))), nil
+}
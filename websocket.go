@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+	"github.com/Qitmeer/qng/rpc/websocket"
+)
+
+// Reconnect delays of a websocket connection with subscriptions.
+const (
+	wsReconnectInitial = time.Second
+	wsReconnectMax     = 30 * time.Second
+	wsDialTimeout      = 10 * time.Second
+)
+
+// errWSClosed is returned for requests on a closed websocket connection.
+var errWSClosed = errors.New("websocket connection closed")
+
+// isWebsocketURL reports whether endpoint is a ws:// or wss:// URL.
+func isWebsocketURL(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "ws" || u.Scheme == "wss")
+}
+
+// Notification is an event pushed by the node on a subscription.
+type Notification struct {
+	Topic    string          `json:"topic"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params"`
+	Endpoint string          `json:"endpoint"`
+	Received time.Time       `json:"received"`
+}
+
+// subscriptionTopic describes how to subscribe to a kind of node event.
+type subscriptionTopic struct {
+	// Method and Params are the subscription request.
+	Method string
+	Params []interface{}
+	// Notifications lists the notification methods the node sends for it.
+	Notifications []string
+}
+
+// SubscriptionTopics are the node events that can be subscribed to. QNG
+// serves them over websocket connections only.
+var SubscriptionTopics = map[string]subscriptionTopic{
+	"blocks": {
+		Method:        "notifyBlocks",
+		Notifications: []string{"blockConnected", "blockDisconnected", "blockAccepted", "reorganization"},
+	},
+	"mempool": {
+		Method:        "notifynewtransactions",
+		Params:        []interface{}{false},
+		Notifications: []string{"txaccepted", "txacceptedverbose"},
+	},
+}
+
+// wsSubscription is an active subscription, replayed after a reconnect.
+type wsSubscription struct {
+	topic   string
+	spec    subscriptionTopic
+	handler func(Notification)
+}
+
+// wsReply is the response to a request sent over a websocket connection.
+type wsReply struct {
+	body []byte
+	err  error
+}
+
+// wsWaiter waits for the response to a request or batch. A batch is
+// registered under all of its request IDs.
+type wsWaiter struct {
+	ids   []uint64
+	reply chan wsReply
+}
+
+// wsConn multiplexes JSON-RPC requests to a node over one websocket
+// connection. Responses are matched to requests by ID, and notifications
+// are handed to the subscriptions. The connection is dialed on first use;
+// while subscriptions are active it is redialed when it drops and the
+// subscriptions are renewed.
+type wsConn struct {
+	name   string
+	url    string
+	nextID func() uint64
+	// authorize returns the Authorization header of the handshake and
+	// tlsConfig secures wss:// connections; both are optional.
+	authorize func() (string, error)
+	tlsConfig *tls.Config
+
+	// writeMu serializes writes; the read loop is the only reader.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	pending map[uint64]*wsWaiter
+	subs    []*wsSubscription
+	closed  bool
+	// reconnecting is set while the reconnect loop runs.
+	reconnecting bool
+}
+
+func newWSConn(name, endpoint string, nextID func() uint64) *wsConn {
+	return &wsConn{
+		name:    name,
+		url:     endpoint,
+		nextID:  nextID,
+		pending: make(map[uint64]*wsWaiter),
+	}
+}
+
+// connect returns the open connection, dialing the node if there is none.
+func (w *wsConn) connect(ctx context.Context) (*websocket.Conn, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, errWSClosed
+	}
+	if w.conn != nil {
+		return w.conn, nil
+	}
+	var header http.Header
+	if w.authorize != nil {
+		auth, err := w.authorize()
+		if err != nil {
+			return nil, err
+		}
+		if auth != "" {
+			header = http.Header{"Authorization": []string{auth}}
+		}
+	}
+	dialer := &websocket.Dialer{
+		TLSClientConfig:  w.tlsConfig,
+		HandshakeTimeout: wsDialTimeout,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.HandshakeTimeout = time.Until(deadline)
+	}
+	conn, resp, err := dialer.Dial(w.url, header)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return nil, httpStatusError(resp.StatusCode)
+		}
+		return nil, err
+	}
+	w.conn = conn
+	go w.readLoop(conn)
+	log.Debug("Websocket connected", "endpoint", w.name)
+	return conn, nil
+}
+
+// roundTrip sends a request or batch and waits for its response.
+func (w *wsConn) roundTrip(ctx context.Context, requestBody []byte) ([]byte, error) {
+	ids, err := requestIDs(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := w.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	waiter := &wsWaiter{ids: ids, reply: make(chan wsReply, 1)}
+	w.mu.Lock()
+	for _, id := range ids {
+		w.pending[id] = waiter
+	}
+	w.mu.Unlock()
+	defer w.forget(waiter)
+
+	w.writeMu.Lock()
+	deadline, _ := ctx.Deadline()
+	conn.SetWriteDeadline(deadline)
+	err = conn.WriteMessage(websocket.TextMessage, requestBody)
+	w.writeMu.Unlock()
+	if err != nil {
+		w.drop(conn, err)
+		return nil, err
+	}
+
+	select {
+	case r := <-waiter.reply:
+		return r.body, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forget removes waiter from the pending requests.
+func (w *wsConn) forget(waiter *wsWaiter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range waiter.ids {
+		if w.pending[id] == waiter {
+			delete(w.pending, id)
+		}
+	}
+}
+
+// readLoop reads messages from conn until it fails.
+func (w *wsConn) readLoop(conn *websocket.Conn) {
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			w.drop(conn, err)
+			return
+		}
+		w.dispatch(msg)
+	}
+}
+
+// dispatch hands a message to the request it answers or to the
+// subscriptions it notifies.
+func (w *wsConn) dispatch(msg []byte) {
+	msg = bytes.TrimSpace(msg)
+	var id uint64
+	if len(msg) > 0 && msg[0] == '[' {
+		var responses []struct {
+			ID *uint64 `json:"id"`
+		}
+		if err := json.Unmarshal(msg, &responses); err != nil || len(responses) == 0 {
+			log.Debug("Websocket message dropped", "endpoint", w.name, "error", err)
+			return
+		}
+		for _, r := range responses {
+			if r.ID != nil {
+				id = *r.ID
+				break
+			}
+		}
+	} else {
+		var m struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			log.Debug("Websocket message dropped", "endpoint", w.name, "error", err)
+			return
+		}
+		if m.Method != "" && (len(m.ID) == 0 || string(m.ID) == "null") {
+			w.notify(m.Method, m.Params)
+			return
+		}
+		if err := json.Unmarshal(m.ID, &id); err != nil {
+			log.Debug("Websocket response with unknown id dropped", "endpoint", w.name, "id", string(m.ID))
+			return
+		}
+	}
+	w.mu.Lock()
+	waiter := w.pending[id]
+	if waiter != nil {
+		for _, id := range waiter.ids {
+			delete(w.pending, id)
+		}
+	}
+	w.mu.Unlock()
+	if waiter == nil {
+		log.Debug("Websocket response without request dropped", "endpoint", w.name, "id", id)
+		return
+	}
+	waiter.reply <- wsReply{body: msg}
+}
+
+// notify hands a notification to the subscriptions of its method.
+func (w *wsConn) notify(method string, params json.RawMessage) {
+	w.mu.Lock()
+	subs := append([]*wsSubscription(nil), w.subs...)
+	w.mu.Unlock()
+	for _, sub := range subs {
+		for _, m := range sub.spec.Notifications {
+			if m == method {
+				sub.handler(Notification{
+					Topic:    sub.topic,
+					Method:   method,
+					Params:   params,
+					Endpoint: w.name,
+					Received: time.Now(),
+				})
+				break
+			}
+		}
+	}
+}
+
+// drop closes conn after it failed, fails the requests waiting on it and
+// starts reconnecting if there are subscriptions to keep.
+func (w *wsConn) drop(conn *websocket.Conn, err error) {
+	w.mu.Lock()
+	if w.conn != conn {
+		w.mu.Unlock()
+		return
+	}
+	w.conn = nil
+	conn.Close()
+	failed := make(map[*wsWaiter]struct{})
+	for id, waiter := range w.pending {
+		failed[waiter] = struct{}{}
+		delete(w.pending, id)
+	}
+	reconnect := !w.closed && len(w.subs) > 0 && !w.reconnecting
+	if reconnect {
+		w.reconnecting = true
+	}
+	w.mu.Unlock()
+
+	if !w.isClosed() {
+		log.Warn("Websocket connection lost", "endpoint", w.name, "error", err)
+	}
+	for waiter := range failed {
+		waiter.reply <- wsReply{err: fmt.Errorf("websocket connection lost: %w", err)}
+	}
+	if reconnect {
+		go w.reconnect()
+	}
+}
+
+func (w *wsConn) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+// reconnect redials the node with backoff and renews the subscriptions.
+func (w *wsConn) reconnect() {
+	defer func() {
+		w.mu.Lock()
+		w.reconnecting = false
+		w.mu.Unlock()
+	}()
+	delay := wsReconnectInitial
+	for attempt := 1; !w.isClosed(); attempt++ {
+		time.Sleep(delay)
+		ctx, cancel := context.WithTimeout(context.Background(), wsDialTimeout)
+		err := w.resubscribe(ctx)
+		cancel()
+		if err == nil {
+			metrics.Inc("ws_reconnects_total", "endpoint", w.name)
+			log.Info("Websocket reconnected", "endpoint", w.name, "attempt", attempt)
+			return
+		}
+		log.Debug("Websocket reconnect failed", "endpoint", w.name, "attempt", attempt, "error", err)
+		if delay *= 2; delay > wsReconnectMax {
+			delay = wsReconnectMax
+		}
+	}
+}
+
+// resubscribe renews every subscription, dialing the node if needed.
+func (w *wsConn) resubscribe(ctx context.Context) error {
+	w.mu.Lock()
+	subs := append([]*wsSubscription(nil), w.subs...)
+	w.mu.Unlock()
+	for _, sub := range subs {
+		if err := w.request(ctx, sub.spec.Method, sub.spec.Params); err != nil {
+			return fmt.Errorf("subscribing to %s: %w", sub.topic, err)
+		}
+	}
+	return nil
+}
+
+// subscribe registers handler for the events of topic.
+func (w *wsConn) subscribe(ctx context.Context, topic string, handler func(Notification)) error {
+	spec, ok := SubscriptionTopics[topic]
+	if !ok {
+		return fmt.Errorf("unknown subscription topic %q", topic)
+	}
+	// registered first, the node may notify before its answer is read
+	sub := &wsSubscription{topic: topic, spec: spec, handler: handler}
+	w.mu.Lock()
+	w.subs = append(w.subs, sub)
+	w.mu.Unlock()
+	if err := w.request(ctx, spec.Method, spec.Params); err != nil {
+		w.mu.Lock()
+		for i, s := range w.subs {
+			if s == sub {
+				w.subs = append(w.subs[:i], w.subs[i+1:]...)
+				break
+			}
+		}
+		w.mu.Unlock()
+		return err
+	}
+	log.Info("Subscribed to node events", "endpoint", w.name, "topic", topic)
+	return nil
+}
+
+// request sends method and checks that the node accepted it.
+func (w *wsConn) request(ctx context.Context, method string, params []interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	requestBody, err := json.Marshal(JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      w.nextID(),
+	})
+	if err != nil {
+		return err
+	}
+	body, err := w.roundTrip(ctx, requestBody)
+	if err != nil {
+		return err
+	}
+	_, err = decodeResponse(body)
+	return err
+}
+
+// close closes the connection for good.
+func (w *wsConn) close() {
+	w.mu.Lock()
+	w.closed = true
+	conn := w.conn
+	w.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// requestIDs returns the IDs of a request or batch body.
+func requestIDs(requestBody []byte) ([]uint64, error) {
+	body := bytes.TrimSpace(requestBody)
+	if len(body) > 0 && body[0] == '[' {
+		var requests []struct {
+			ID uint64 `json:"id"`
+		}
+		if err := json.Unmarshal(body, &requests); err != nil {
+			return nil, err
+		}
+		ids := make([]uint64, len(requests))
+		for i, r := range requests {
+			ids[i] = r.ID
+		}
+		return ids, nil
+	}
+	var request struct {
+		ID uint64 `json:"id"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	return []uint64{request.ID}, nil
+}
+
+// Subscribe subscribes handler to the node events of topic, see
+// SubscriptionTopics. The subscription is made on the preferred websocket
+// endpoint and renewed whenever its connection is reestablished.
+func (c *Client) Subscribe(ctx context.Context, topic string, handler func(Notification)) error {
+	for _, e := range c.endpoints {
+		if e.ws != nil {
+			return e.ws.subscribe(ctx, topic, handler)
+		}
+	}
+	return fmt.Errorf("subscribing to %s needs a ws:// or wss:// endpoint", topic)
+}
+
+// Close closes the websocket connections of the client.
+func (c *Client) Close() {
+	for _, e := range c.endpoints {
+		if e.ws != nil {
+			e.ws.close()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qng/rpc/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// wsNode is a fake node serving JSON-RPC over websocket connections.
+// qng_echo answers params[1] after params[0] milliseconds, so responses can
+// overtake each other; notifyBlocks answers and pushes a blockConnected
+// notification.
+type wsNode struct {
+	*httptest.Server
+	subscriptions atomic.Int32
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+}
+
+func newWSNode(t *testing.T) *wsNode {
+	n := &wsNode{}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, nil, 0, 0)
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		n.conns = append(n.conns, conn)
+		n.mu.Unlock()
+		n.serve(conn)
+	}))
+	t.Cleanup(func() {
+		n.drop()
+		n.Close()
+	})
+	return n
+}
+
+// URL returns the ws:// URL of the node.
+func (n *wsNode) URL() string {
+	return "ws" + strings.TrimPrefix(n.Server.URL, "http")
+}
+
+func (n *wsNode) serve(conn *websocket.Conn) {
+	var writeMu sync.Mutex
+	write := func(v interface{}) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.WriteJSON(v)
+	}
+	answer := func(req JSONRPCRequest) JSONRPCResponse {
+		switch req.Method {
+		case "notifyBlocks":
+			n.subscriptions.Add(1)
+			return JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("null")}
+		case "qng_echo":
+			time.Sleep(time.Duration(req.Params[0].(float64)) * time.Millisecond)
+			result, _ := json.Marshal(req.Params[1])
+			return JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+		}
+		return JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: rpcCodeMethodNotFound, Message: "Method not found"}}
+	}
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msg[0] == '[' {
+			var reqs []JSONRPCRequest
+			json.Unmarshal(msg, &reqs)
+			resps := make([]JSONRPCResponse, len(reqs))
+			for i, req := range reqs {
+				resps[i] = answer(req)
+			}
+			write(resps)
+			continue
+		}
+		var req JSONRPCRequest
+		json.Unmarshal(msg, &req)
+		go func() {
+			write(answer(req))
+			if req.Method == "notifyBlocks" {
+				write(map[string]interface{}{
+					"jsonrpc": "1.0",
+					"id":      nil,
+					"method":  "blockConnected",
+					"params":  []interface{}{"ab", 10, 12, 1700000000, []string{}},
+				})
+			}
+		}()
+	}
+}
+
+// drop closes every connection to the node.
+func (n *wsNode) drop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, conn := range n.conns {
+		conn.Close()
+	}
+	n.conns = nil
+}
+
+func TestWebsocketMultiplexing(t *testing.T) {
+	node := newWSNode(t)
+	c := NewClient(node.URL())
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// later requests are answered first
+			var got int
+			if err := c.Call(context.Background(), "qng_echo", []interface{}{(10 - i) * 5, i}, &got); err != nil {
+				t.Error(err)
+			}
+			if got != i {
+				t.Errorf("Expected response %d, got %d", i, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	results, err := c.CallBatch(context.Background(), []BatchCall{
+		{Method: "qng_echo", Params: []interface{}{0, "a"}},
+		{Method: "qng_unknown"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(results[0].Result) != `"a"` || results[1].Err == nil {
+		t.Errorf("Unexpected batch results: %+v", results)
+	}
+
+	node.drop()
+	var got string
+	if err := c.Call(context.Background(), "qng_echo", []interface{}{0, "again"}, &got); err != nil || got != "again" {
+		t.Errorf("Expected the connection to be redialed, got %q, %v", got, err)
+	}
+}
+
+func TestWebsocketSubscription(t *testing.T) {
+	node := newWSNode(t)
+	rpc := NewClient(node.URL())
+	defer rpc.Close()
+	s := NewMCPServer(rpc)
+	c := newTestClient(t, s)
+	// mcp-go v0.25 drops the uri param when it writes notifications, so
+	// only the method is checked
+	updated := make(chan struct{}, 10)
+	c.OnNotification(func(n mcp.JSONRPCNotification) {
+		if n.Method == methodResourceUpdated {
+			updated <- struct{}{}
+		}
+	})
+
+	if err := s.SubscribeNode(context.Background(), []string{"blocks"}); err != nil {
+		t.Fatal(err)
+	}
+	waitUpdate := func() {
+		t.Helper()
+		select {
+		case <-updated:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a resource update notification")
+		}
+	}
+	waitUpdate()
+
+	// the subscription is renewed after the connection drops
+	node.drop()
+	waitUpdate()
+	if n := node.subscriptions.Load(); n != 2 {
+		t.Errorf("Expected 2 subscriptions, got %d", n)
+	}
+
+	read := mcp.ReadResourceRequest{}
+	read.Params.URI = "qng://events/blocks"
+	resource, err := c.ReadResource(context.Background(), read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Notification
+	if err := json.Unmarshal([]byte(resource.Contents[0].(mcp.TextResourceContents).Text), &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Method != "blockConnected" || events[0].Topic != "blocks" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+
+	if err := NewClient("http://127.0.0.1:1/").Subscribe(context.Background(), "blocks", nil); err == nil {
+		t.Error("Expected subscriptions to need a websocket endpoint")
+	}
+}